@@ -0,0 +1,123 @@
+// checkpoint/checkpoint.go
+package checkpoint
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Slice is the committed position of one slice of an export: the point in
+// time it pages through and the sort values of the last hit written.
+type Slice struct {
+	PITID       string        `json:"pit_id,omitempty"`
+	SearchAfter []interface{} `json:"search_after,omitempty"`
+	Pages       int           `json:"pages"`
+}
+
+// State is the progress of an export as of its last checkpoint. Everything
+// up to Offset bytes of the output was written by the pages recorded in
+// Slices; anything after it is discarded on resume.
+type State struct {
+	// Query is the rendered query, which a resumed export runs again.
+	// Index, Sink and Output identify the export, so a checkpoint is not
+	// resumed by a different one.
+	Query  string `json:"query"`
+	Index  string `json:"index"`
+	Sink   string `json:"sink"`
+	Output string `json:"output"`
+
+	Slices    []Slice   `json:"slices"`
+	Documents int64     `json:"documents"`
+	Offset    int64     `json:"offset"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// New returns the state of an export that has not written anything yet.
+func New(query, index, sink, output string, slices int) *State {
+	return &State{
+		Query:  query,
+		Index:  index,
+		Sink:   sink,
+		Output: output,
+		Slices: make([]Slice, slices),
+	}
+}
+
+// Load reads the state saved at path. The error satisfies
+// errors.Is(err, os.ErrNotExist) if there is no checkpoint.
+func Load(path string) (*State, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read checkpoint: %w", err)
+	}
+
+	// Sort values are often 64-bit integers such as timestamps or
+	// _shard_doc, which must survive the round trip exactly.
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var state State
+	if err := dec.Decode(&state); err != nil {
+		return nil, fmt.Errorf("failed to parse checkpoint %s: %w", path, err)
+	}
+	return &state, nil
+}
+
+// Save writes the state to path. The file is replaced atomically, so a crash
+// while saving leaves the previous checkpoint intact.
+func (s *State) Save(path string) error {
+	s.UpdatedAt = time.Now().UTC()
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode checkpoint: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create checkpoint: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace checkpoint: %w", err)
+	}
+	return nil
+}
+
+// Remove deletes the checkpoint at path, if any.
+func Remove(path string) error {
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove checkpoint: %w", err)
+	}
+	return nil
+}
+
+// Check reports why s cannot be resumed by the export described by other.
+func (s *State) Check(other *State) error {
+	switch {
+	case s.Index != other.Index:
+		return fmt.Errorf("checkpoint was taken on index %q, not %q", s.Index, other.Index)
+	case s.Sink != other.Sink:
+		return fmt.Errorf("checkpoint was taken with sink %q, not %q", s.Sink, other.Sink)
+	case s.Output != other.Output:
+		return fmt.Errorf("checkpoint was taken writing to %q, not %q", s.Output, other.Output)
+	case len(s.Slices) != len(other.Slices):
+		return fmt.Errorf("checkpoint was taken with %d workers, not %d", len(s.Slices), len(other.Slices))
+	}
+	return nil
+}
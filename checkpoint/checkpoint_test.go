@@ -0,0 +1,59 @@
+// checkpoint/checkpoint_test.go
+package checkpoint
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSaveAndLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "export.checkpoint")
+	if _, err := Load(path); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("Expected a missing checkpoint to be reported as such, got %v", err)
+	}
+
+	state := New(`{"query":{"match_all":{}}}`, "logs", "jsonl", "out.jsonl", 2)
+	state.Slices[1] = Slice{
+		PITID: "pit-1",
+		// Larger than 2^53, so it would lose precision as a float64.
+		SearchAfter: []interface{}{json.Number("1700000000000"), json.Number("9007199254740993")},
+		Pages:       3,
+	}
+	state.Documents = 30
+	state.Offset = 4096
+	if err := state.Save(path); err != nil {
+		t.Fatalf("Error saving checkpoint: %s", err)
+	}
+
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatalf("Error loading checkpoint: %s", err)
+	}
+	if loaded.Offset != 4096 || loaded.Documents != 30 || loaded.Query != state.Query {
+		t.Errorf("Unexpected checkpoint %+v", loaded)
+	}
+	if got := loaded.Slices[1].SearchAfter[1]; got != json.Number("9007199254740993") {
+		t.Errorf("Expected sort value 9007199254740993 but got %v", got)
+	}
+	if loaded.Slices[0].SearchAfter != nil {
+		t.Errorf("Expected slice 0 to start from the beginning, got %v", loaded.Slices[0].SearchAfter)
+	}
+
+	if err := loaded.Check(New("", "logs", "jsonl", "out.jsonl", 2)); err != nil {
+		t.Errorf("Expected checkpoint to match, got: %s", err)
+	}
+	if err := loaded.Check(New("", "logs", "csv", "out.jsonl", 2)); err == nil || !strings.Contains(err.Error(), `sink "jsonl"`) {
+		t.Errorf("Expected sink mismatch, got: %v", err)
+	}
+
+	if err := Remove(path); err != nil {
+		t.Fatalf("Error removing checkpoint: %s", err)
+	}
+	if err := Remove(path); err != nil {
+		t.Errorf("Expected removing a missing checkpoint to succeed, got: %s", err)
+	}
+}
@@ -0,0 +1,81 @@
+// cli/checkpoint.go
+package cli
+
+import (
+	"time"
+
+	"github.com/terenzio/ElasticSearchQuerier/checkpoint"
+	"github.com/terenzio/ElasticSearchQuerier/client"
+	"github.com/terenzio/ElasticSearchQuerier/processor"
+	"github.com/terenzio/ElasticSearchQuerier/querier"
+)
+
+// checkpointer records the pages written by an export and saves them to the
+// checkpoint file at most once per interval. The sink is flushed before each
+// save, so the saved offset covers exactly the recorded pages.
+type checkpointer struct {
+	path     string
+	interval time.Duration
+	sink     processor.Resumable
+	state    *checkpoint.State
+	saved    time.Time
+}
+
+var _ querier.Progress = (*checkpointer)(nil)
+
+func newCheckpointer(path string, interval time.Duration, sink processor.Resumable, state *checkpoint.State) *checkpointer {
+	return &checkpointer{
+		path:     path,
+		interval: interval,
+		sink:     sink,
+		state:    state,
+		saved:    time.Now(),
+	}
+}
+
+// positions returns where each slice resumes.
+func (c *checkpointer) positions() []client.Position {
+	positions := make([]client.Position, len(c.state.Slices))
+	for i, slice := range c.state.Slices {
+		positions[i] = client.Position{
+			ScrollID:    slice.PITID,
+			SearchAfter: slice.SearchAfter,
+			Pages:       slice.Pages,
+		}
+	}
+	return positions
+}
+
+// Written records a page the sink has accepted and saves the checkpoint if
+// the interval has passed.
+func (c *checkpointer) Written(page *client.Page) error {
+	c.state.Slices[page.Slice] = checkpoint.Slice{
+		PITID:       page.ScrollID,
+		SearchAfter: page.SearchAfter,
+		Pages:       page.Number,
+	}
+	c.state.Documents += int64(len(page.Hits) + page.Streamed)
+
+	if time.Since(c.saved) < c.interval {
+		return nil
+	}
+	return c.save()
+}
+
+// Stopped saves the pages written by an export that failed.
+func (c *checkpointer) Stopped() error {
+	return c.save()
+}
+
+func (c *checkpointer) save() error {
+	offset, err := c.sink.Offset()
+	if err != nil {
+		return err
+	}
+	c.state.Offset = offset
+	if err := c.state.Save(c.path); err != nil {
+		return err
+	}
+	c.saved = time.Now()
+	return nil
+}
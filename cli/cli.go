@@ -0,0 +1,318 @@
+// cli/cli.go
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v8"
+
+	"github.com/terenzio/ElasticSearchQuerier/client"
+	"github.com/terenzio/ElasticSearchQuerier/config"
+	"github.com/terenzio/ElasticSearchQuerier/logging"
+	"github.com/terenzio/ElasticSearchQuerier/metrics"
+	"github.com/terenzio/ElasticSearchQuerier/querier"
+	"github.com/terenzio/ElasticSearchQuerier/querytemplate"
+	"github.com/terenzio/ElasticSearchQuerier/tracing"
+)
+
+// Exit codes returned by Run.
+const (
+	ExitOK         = 0
+	ExitFailure    = 1 // the command ran but failed, e.g. writing output
+	ExitUsage      = 2 // unknown command or bad flags
+	ExitConfig     = 3 // invalid configuration or missing input files
+	ExitConnection = 4 // Elasticsearch could not be reached or refused us
+	ExitQuery      = 5 // Elasticsearch rejected the query or index
+	// 128 plus SIGINT, as a shell reports a process killed by Ctrl-C
+	ExitInterrupted = 130 // stopped by a signal
+)
+
+type command struct {
+	name    string
+	summary string
+	run     func(args []string, stdout, stderr io.Writer) error
+}
+
+var commands = []command{
+	{"export", "export matching documents to a sink", runExport},
+	{"count", "print the number of documents matching the query", runCount},
+	{"validate", "check the query against the index without running it", runValidate},
+	{"import", "load a _bulk NDJSON file into an index", runImport},
+	{"serve", "run exports submitted over a REST API", runServe},
+	{"mappings", "print the index mapping", runMappings},
+	{"config", "print the effective configuration with secrets masked", runConfig},
+}
+
+// Main runs the command line and exits with its status.
+func Main() {
+	os.Exit(Run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// Run executes the subcommand named by args[0] and returns the exit code.
+// Without a subcommand, or if args starts with a flag, it runs the command
+// named by the mode setting (export by default), so the binary keeps
+// working as a plain "./main".
+func Run(args []string, stdout, stderr io.Writer) int {
+	var name string
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	} else {
+		cfg, err := loadConfig(args)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return exitCode(err)
+		}
+		name = cfg.Mode
+	}
+
+	switch name {
+	case "help", "-h", "--help":
+		usage(stdout)
+		return ExitOK
+	}
+	for _, cmd := range commands {
+		if cmd.name == name {
+			err := cmd.run(args, stdout, stderr)
+			if err != nil && !errors.Is(err, flag.ErrHelp) {
+				fmt.Fprintf(stderr, "%s: %s\n", name, logging.Redact(err.Error()))
+			}
+			return exitCode(err)
+		}
+	}
+
+	fmt.Fprintf(stderr, "unknown command %q\n\n", name)
+	usage(stderr)
+	return ExitUsage
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintf(w, "Usage: %s <command> [flags]\n\nCommands:\n", programName())
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-10s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintf(w, "\nRun '%s <command> -help' for the flags of a command.\n", programName())
+	fmt.Fprintf(w, "\nExit codes: %d ok, %d failure, %d usage, %d config, %d connection, %d query, %d interrupted\n",
+		ExitOK, ExitFailure, ExitUsage, ExitConfig, ExitConnection, ExitQuery, ExitInterrupted)
+}
+
+func programName() string {
+	if len(os.Args) > 0 {
+		return os.Args[0]
+	}
+	return "ElasticSearchQuerier"
+}
+
+// exitError attaches an exit code to an error.
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string { return e.err.Error() }
+func (e *exitError) Unwrap() error { return e.err }
+
+func configError(err error) error {
+	return &exitError{code: ExitConfig, err: err}
+}
+
+func usageError(err error) error {
+	return &exitError{code: ExitUsage, err: err}
+}
+
+// exitCode maps an error to an exit code. Errors from Elasticsearch are
+// classified here: no response or an authentication failure is a
+// connection error, any other 4xx a query error.
+func exitCode(err error) int {
+	if err == nil || errors.Is(err, flag.ErrHelp) {
+		return ExitOK
+	}
+
+	var exitErr *exitError
+	if errors.As(err, &exitErr) {
+		return exitErr.code
+	}
+	if errors.Is(err, querier.ErrStopped) || errors.Is(err, context.Canceled) {
+		return ExitInterrupted
+	}
+
+	var respErr *client.ResponseError
+	if errors.As(err, &respErr) {
+		switch {
+		case respErr.StatusCode == 401 || respErr.StatusCode == 403:
+			return ExitConnection
+		case respErr.StatusCode >= 400 && respErr.StatusCode < 500:
+			return ExitQuery
+		default:
+			return ExitConnection
+		}
+	}
+	if errors.Is(err, client.ErrRequestFailed) {
+		return ExitConnection
+	}
+	return ExitFailure
+}
+
+// loadConfig builds the configuration of a command from the config file and
+// profile named by the -config and -profile flags in args, or by the
+// CONFIG_FILE and CONFIG_PROFILE environment variables, and the
+// environment. The remaining flags are applied later by parseFlags.
+func loadConfig(args []string) (*config.Config, error) {
+	path := os.Getenv(config.EnvConfigFile)
+	profile := os.Getenv(config.EnvConfigProfile)
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" || !strings.HasPrefix(arg, "-") {
+			break
+		}
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if name != "config" && name != "profile" {
+			continue
+		}
+		if !hasValue {
+			if i+1 >= len(args) {
+				break // reported by the flag set
+			}
+			i++
+			value = args[i]
+		}
+		if name == "config" {
+			path = value
+		} else {
+			profile = value
+		}
+	}
+
+	cfg, err := config.Load(path, profile)
+	if err != nil {
+		return nil, configError(err)
+	}
+	return cfg, nil
+}
+
+// newFlagSet returns a flag set for a subcommand that reports errors
+// instead of exiting. It accepts -config and -profile, which loadConfig has
+// already applied.
+func newFlagSet(name string, stderr io.Writer) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.String("config", "", "config file, YAML or TOML (default $"+config.EnvConfigFile+")")
+	fs.String("profile", "", "profile of the config file to apply (default $"+config.EnvConfigProfile+")")
+	return fs
+}
+
+// parseFlags parses args into fs, validates cfg and makes the logger it
+// configures, writing to the output of fs, the default.
+func parseFlags(fs *flag.FlagSet, args []string, cfg *config.Config) error {
+	cfg.BindFlags(fs, "log-level", "log-format")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return usageError(err)
+	}
+	if fs.NArg() > 0 {
+		return usageError(fmt.Errorf("unexpected arguments: %s", strings.Join(fs.Args(), " ")))
+	}
+	if err := cfg.Validate(); err != nil {
+		return configError(err)
+	}
+
+	level, err := logging.ParseLevel(cfg.LogLevel)
+	if err != nil {
+		return configError(err)
+	}
+	logger, err := logging.New(fs.Output(), cfg.LogFormat, level)
+	if err != nil {
+		return configError(err)
+	}
+	slog.SetDefault(logger)
+	return nil
+}
+
+// connectionFlags binds the flags selecting the cluster, the credentials,
+// the retry policy and the index. Secrets themselves can only be given as
+// files or in the environment.
+func connectionFlags(fs *flag.FlagSet, cfg *config.Config) {
+	cfg.BindFlags(fs, "es-url", "cloud-id", "username", "password-file", "api-key-file", "service-token-file",
+		"ca-cert", "ca-fingerprint", "client-cert", "client-key", "insecure",
+		"retry-initial-interval", "retry-max-interval", "retry-max-elapsed-time", "index")
+}
+
+// queryFlags binds the flags selecting the query template and its values.
+func queryFlags(fs *flag.FlagSet, cfg *config.Config, params querytemplate.Values) {
+	cfg.BindFlags(fs, "query-file", "params-file")
+	fs.Var(params, "param", "query parameter as name=value (repeatable)")
+}
+
+func newESClient(cfg *config.Config) (*elasticsearch.Client, error) {
+	esClient, err := config.NewESClient(cfg)
+	if err != nil {
+		return nil, configError(fmt.Errorf("failed to create Elasticsearch client: %w", err))
+	}
+	return esClient, nil
+}
+
+// serveMetrics starts the metrics listener if cfg has an address for it,
+// and returns the function stopping it.
+func serveMetrics(cfg *config.Config) (func(), error) {
+	if cfg.MetricsAddr == "" {
+		return func() {}, nil
+	}
+	server, err := metrics.Serve(cfg.MetricsAddr)
+	if err != nil {
+		return nil, configError(err)
+	}
+	return func() { server.Close() }, nil
+}
+
+// startTracing installs the trace exporter selected by cfg, and returns the
+// function flushing the spans left when the command ends.
+func startTracing(cfg *config.Config) (func(), error) {
+	shutdown, err := tracing.Setup(context.Background(), cfg.TraceExporter, cfg.OTLPEndpoint)
+	if err != nil {
+		return nil, configError(err)
+	}
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdown(ctx); err != nil {
+			slog.Warn("Failed to export traces", "error", err)
+		}
+	}, nil
+}
+
+// loadQuery reads cfg.QueryFile and fills in its placeholders from, in
+// increasing precedence, the params file, the environment and -param flags.
+func loadQuery(cfg *config.Config, flagValues querytemplate.Values) (string, error) {
+	query, err := os.ReadFile(cfg.QueryFile)
+	if err != nil {
+		return "", configError(fmt.Errorf("failed to read query file: %w", err))
+	}
+
+	tmpl, err := querytemplate.Parse(string(query))
+	if err != nil {
+		return "", configError(fmt.Errorf("failed to parse query template: %w", err))
+	}
+
+	var fileValues querytemplate.Values
+	if cfg.ParamsFile != "" {
+		if fileValues, err = querytemplate.LoadFile(cfg.ParamsFile); err != nil {
+			return "", configError(err)
+		}
+	}
+
+	values := querytemplate.Merge(fileValues, querytemplate.FromEnv(tmpl), flagValues)
+	rendered, err := tmpl.Render(values, time.Now())
+	if err != nil {
+		return "", configError(err)
+	}
+	return rendered, nil
+}
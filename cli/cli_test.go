@@ -0,0 +1,55 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/terenzio/ElasticSearchQuerier/client"
+	"github.com/terenzio/ElasticSearchQuerier/querier"
+)
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		err      error
+		expected int
+	}{
+		{nil, ExitOK},
+		{errors.New("disk full"), ExitFailure},
+		{configError(errors.New("bad")), ExitConfig},
+		{fmt.Errorf("search: %w", &client.ResponseError{StatusCode: 400}), ExitQuery},
+		{fmt.Errorf("search: %w", &client.ResponseError{StatusCode: 404}), ExitQuery},
+		{fmt.Errorf("search: %w", &client.ResponseError{StatusCode: 401}), ExitConnection},
+		{fmt.Errorf("search: %w", &client.ResponseError{StatusCode: 503}), ExitConnection},
+		{fmt.Errorf("search: %w: dial tcp: refused", client.ErrRequestFailed), ExitConnection},
+		{fmt.Errorf("failed to export: %w", querier.ErrStopped), ExitInterrupted},
+		{fmt.Errorf("scroll request failed: %w", context.Canceled), ExitInterrupted},
+	}
+	for _, test := range tests {
+		if got := exitCode(test.err); got != test.expected {
+			t.Errorf("Expected exit code %d for %v but got %d", test.expected, test.err, got)
+		}
+	}
+}
+
+func TestRunUnknownCommand(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	if code := Run([]string{"frobnicate"}, &stdout, &stderr); code != ExitUsage {
+		t.Errorf("Expected exit code %d but got %d", ExitUsage, code)
+	}
+	if !bytes.Contains(stderr.Bytes(), []byte(`unknown command "frobnicate"`)) {
+		t.Errorf("Expected an unknown command message but got %q", stderr.String())
+	}
+}
+
+func TestRunInvalidFlags(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	if code := Run([]string{"export", "-batch-size", "0"}, &stdout, &stderr); code != ExitConfig {
+		t.Errorf("Expected exit code %d but got %d", ExitConfig, code)
+	}
+	if code := Run([]string{"export", "-no-such-flag"}, &stdout, &stderr); code != ExitUsage {
+		t.Errorf("Expected exit code %d but got %d", ExitUsage, code)
+	}
+}
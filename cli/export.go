@@ -0,0 +1,164 @@
+// cli/export.go
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/terenzio/ElasticSearchQuerier/checkpoint"
+	"github.com/terenzio/ElasticSearchQuerier/client"
+	"github.com/terenzio/ElasticSearchQuerier/processor"
+	"github.com/terenzio/ElasticSearchQuerier/querier"
+	"github.com/terenzio/ElasticSearchQuerier/querytemplate"
+)
+
+func runExport(args []string, stdout, stderr io.Writer) error {
+	cfg, err := loadConfig(args)
+	if err != nil {
+		return err
+	}
+	params := make(querytemplate.Values)
+	var resume bool
+
+	fs := newFlagSet("export", stderr)
+	connectionFlags(fs, cfg)
+	queryFlags(fs, cfg, params)
+	cfg.BindFlags(fs, "sink", "output", "batch-size", "scroll-duration", "pagination", "workers", "stream",
+		"metadata", "columns", "array-mode", "array-separator", "row-group-rows", "dead-letter", "checkpoint", "checkpoint-interval",
+		"metrics-addr", "trace-exporter", "otlp-endpoint")
+	fs.Lookup("sink").Usage = "output sink: " + strings.Join(processor.Names(), ", ")
+	fs.BoolVar(&resume, "resume", false, "continue the export recorded in the checkpoint file")
+	if err := parseFlags(fs, args, cfg); err != nil {
+		return err
+	}
+	if resume && cfg.CheckpointFile == "" {
+		return configError(errors.New("-resume requires a checkpoint file"))
+	}
+
+	// Initialize Elasticsearch client
+	esClient, err := newESClient(cfg)
+	if err != nil {
+		return err
+	}
+	stopMetrics, err := serveMetrics(cfg)
+	if err != nil {
+		return err
+	}
+	defer stopMetrics()
+	stopTracing, err := startTracing(cfg)
+	if err != nil {
+		return err
+	}
+	defer stopTracing()
+
+	// Read the checkpoint of the export being resumed, whose query is reused
+	// as rendered then, so relative dates keep their original meaning
+	var state *checkpoint.State
+	var query string
+	if resume {
+		state, err = checkpoint.Load(cfg.CheckpointFile)
+		if err != nil {
+			return configError(err)
+		}
+		if err := state.Check(checkpoint.New("", cfg.IndexName, cfg.Sink, cfg.OutputPath, cfg.Workers)); err != nil {
+			return configError(err)
+		}
+		query = state.Query
+	} else {
+		// Read and render the query template
+		if query, err = loadQuery(cfg, params); err != nil {
+			return err
+		}
+		state = checkpoint.New(query, cfg.IndexName, cfg.Sink, cfg.OutputPath, cfg.Workers)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Create the output sink, which the querier opens and closes
+	sink, err := processor.New(cfg.Sink, processor.Options{
+		Path:           cfg.OutputPath,
+		Metadata:       cfg.SinkMetadata,
+		Columns:        cfg.Columns,
+		ArrayMode:      cfg.ArrayMode,
+		ArraySeparator: cfg.ArraySeparator,
+		Mapping: func() (map[string]interface{}, error) {
+			return client.GetMapping(ctx, esClient, cfg.RetryPolicy(), cfg.IndexName)
+		},
+		RowGroupRows: cfg.RowGroupRows,
+	})
+	if err != nil {
+		return configError(fmt.Errorf("failed to create sink: %w", err))
+	}
+	// Instrument the sink here rather than in the querier, so the flushes
+	// of the checkpointer are measured too
+	sink = processor.Instrument(sink)
+
+	// Hits that cannot be parsed are set aside rather than failing the export
+	deadLetter := processor.NewDeadLetter(cfg.DeadLetterPath, resume)
+	defer func() {
+		if err := deadLetter.Close(); err != nil {
+			slog.Warn("Failed to close dead-letter file", "error", err)
+		}
+	}()
+
+	opts := []querier.Option{
+		querier.WithIndex(cfg.IndexName),
+		querier.WithQuery(query),
+		querier.WithBatchSize(cfg.BatchSize),
+		querier.WithKeepAlive(cfg.ScrollDuration),
+		querier.WithPagination(cfg.PaginationMode),
+		querier.WithWorkers(cfg.Workers),
+		querier.WithStreaming(cfg.Stream),
+		querier.WithSink(sink),
+		querier.WithDeadLetter(deadLetter),
+		querier.WithRetryPolicy(cfg.RetryPolicy()),
+	}
+	if cfg.CheckpointFile != "" {
+		resumable, ok := sink.(processor.Resumable)
+		if !ok {
+			return configError(fmt.Errorf("sink %q does not support checkpoints", cfg.Sink))
+		}
+		progress := newCheckpointer(cfg.CheckpointFile, cfg.CheckpointEvery, resumable, state)
+		opts = append(opts, querier.WithProgress(progress))
+		if resume {
+			slog.Info("Resuming export", "index", cfg.IndexName, "docs", state.Documents)
+			opts = append(opts, querier.WithResume(progress.positions(), state.Offset))
+		}
+	}
+	q, err := querier.New(esClient, opts...)
+	if err != nil {
+		return configError(err)
+	}
+
+	// On SIGINT or SIGTERM finish the page in hand, so the output and the
+	// checkpoint end on the same page, close the sink and release the
+	// search contexts
+	defer handleSignals(q.Stop, cancel)()
+
+	start := time.Now()
+	stats, err := q.Export(ctx)
+	summary := []any{"index", cfg.IndexName, "docs", stats.Documents, "pages", stats.Pages,
+		"malformed", stats.Malformed, "recoveries", stats.Recoveries, "duration", time.Since(start)}
+	if err != nil {
+		slog.Warn("Export stopped", summary...)
+		if cfg.CheckpointFile != "" && errors.Is(err, querier.ErrStopped) {
+			slog.Info("Run again with -resume to continue", "checkpoint", cfg.CheckpointFile)
+		}
+		return err
+	}
+	slog.Info("Export finished", summary...)
+	if n := deadLetter.Count(); n > 0 && cfg.DeadLetterPath != "" {
+		slog.Warn("Skipped malformed hits", "malformed", n, "dead_letter", cfg.DeadLetterPath)
+	}
+
+	if cfg.CheckpointFile != "" {
+		return checkpoint.Remove(cfg.CheckpointFile)
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/terenzio/ElasticSearchQuerier/estest"
+	"github.com/terenzio/ElasticSearchQuerier/metrics"
+)
+
+// exportArgs returns the arguments exporting the logs index of server as
+// JSON lines into dir, two documents per page.
+func exportArgs(t *testing.T, server *estest.Server, dir string, extra ...string) []string {
+	queryFile := filepath.Join(dir, "query.json")
+	if err := os.WriteFile(queryFile, []byte(`{"query":{"match_all":{}},"sort":[{"n":"asc"}]}`), 0o644); err != nil {
+		t.Fatalf("Error writing query: %s", err)
+	}
+	args := []string{"export",
+		"-es-url", server.URL, "-index", "logs", "-query-file", queryFile,
+		"-sink", "jsonl", "-output", filepath.Join(dir, "out.jsonl"),
+		"-dead-letter", filepath.Join(dir, "dead.jsonl"),
+		"-batch-size", "2", "-pagination", "pit",
+		"-retry-initial-interval", "1ms", "-retry-max-interval", "1ms",
+	}
+	return append(args, extra...)
+}
+
+func newLogServer(t *testing.T, n int) *estest.Server {
+	server := estest.New(t)
+	for i := 1; i <= n; i++ {
+		server.Index("logs", estest.Doc{ID: fmt.Sprint(i), Source: map[string]interface{}{"n": i}})
+	}
+	return server
+}
+
+func TestExportRetriesRejections(t *testing.T) {
+	server := newLogServer(t, 5)
+	server.Fail(estest.OpenPIT, 1, estest.Rejected)
+	server.Fail(estest.Search, 2, estest.Unavailable)
+	dir := t.TempDir()
+
+	var stdout, stderr bytes.Buffer
+	if code := Run(exportArgs(t, server, dir), &stdout, &stderr); code != ExitOK {
+		t.Fatalf("Expected exit code %d but got %d: %s", ExitOK, code, stderr.String())
+	}
+
+	output, err := os.ReadFile(filepath.Join(dir, "out.jsonl"))
+	if err != nil {
+		t.Fatalf("Error reading output: %s", err)
+	}
+	if lines := strings.Count(string(output), "\n"); lines != 5 {
+		t.Errorf("Expected 5 documents but got %d", lines)
+	}
+	if n := server.OpenContexts(); n != 0 {
+		t.Errorf("Expected the point in time to be closed, %d contexts left open", n)
+	}
+}
+
+func TestExportResumesAfterShardFailure(t *testing.T) {
+	server := newLogServer(t, 5)
+	dir := t.TempDir()
+	checkpointFile := filepath.Join(dir, "export.checkpoint")
+
+	// The second page comes back incomplete, which stops the export after
+	// the first one.
+	server.Fail(estest.Search, 1, estest.Fault{})
+	server.Fail(estest.Search, 1, estest.ShardFailure)
+	var stdout, stderr bytes.Buffer
+	code := Run(exportArgs(t, server, dir, "-checkpoint", checkpointFile), &stdout, &stderr)
+	if code != ExitFailure {
+		t.Fatalf("Expected exit code %d but got %d: %s", ExitFailure, code, stderr.String())
+	}
+	if _, err := os.Stat(checkpointFile); err != nil {
+		t.Fatalf("Expected a checkpoint: %s", err)
+	}
+
+	stderr.Reset()
+	code = Run(exportArgs(t, server, dir, "-checkpoint", checkpointFile, "-resume"), &stdout, &stderr)
+	if code != ExitOK {
+		t.Fatalf("Expected exit code %d but got %d: %s", ExitOK, code, stderr.String())
+	}
+
+	output, err := os.ReadFile(filepath.Join(dir, "out.jsonl"))
+	if err != nil {
+		t.Fatalf("Error reading output: %s", err)
+	}
+	var ns []string
+	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		ns = append(ns, strings.TrimPrefix(strings.TrimSuffix(line, "}"), `{"n":`))
+	}
+	if strings.Join(ns, " ") != "1 2 3 4 5" {
+		t.Errorf("Expected each document once in order but got %q", output)
+	}
+	if _, err := os.Stat(checkpointFile); !os.IsNotExist(err) {
+		t.Errorf("Expected the checkpoint to be removed, got %v", err)
+	}
+}
+
+func TestExportRecordsMetrics(t *testing.T) {
+	server := newLogServer(t, 5)
+	server.Fail(estest.Search, 1, estest.Rejected)
+	dir := t.TempDir()
+
+	counters := map[string]func() float64{
+		"fetched":  func() float64 { return testutil.ToFloat64(metrics.DocumentsFetched) },
+		"written":  func() float64 { return testutil.ToFloat64(metrics.DocumentsWritten) },
+		"pages":    func() float64 { return testutil.ToFloat64(metrics.Pages) },
+		"bytes":    func() float64 { return testutil.ToFloat64(metrics.BytesWritten) },
+		"retries":  func() float64 { return testutil.ToFloat64(metrics.Retries.WithLabelValues("search")) },
+		"rejected": func() float64 { return testutil.ToFloat64(metrics.Errors.WithLabelValues(metrics.ClassRejected)) },
+	}
+	before := make(map[string]float64)
+	for name, value := range counters {
+		before[name] = value()
+	}
+
+	var stdout, stderr bytes.Buffer
+	if code := Run(exportArgs(t, server, dir), &stdout, &stderr); code != ExitOK {
+		t.Fatalf("Expected exit code %d but got %d: %s", ExitOK, code, stderr.String())
+	}
+	info, err := os.Stat(filepath.Join(dir, "out.jsonl"))
+	if err != nil {
+		t.Fatalf("Error reading output: %s", err)
+	}
+
+	// Three pages of hits and the empty one ending the search
+	expected := map[string]float64{
+		"fetched": 5, "written": 5, "pages": 4, "bytes": float64(info.Size()), "retries": 1, "rejected": 1,
+	}
+	for name, value := range counters {
+		if got := value() - before[name]; got != expected[name] {
+			t.Errorf("Expected %s to grow by %v but got %v", name, expected[name], got)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+// cli/import.go
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/terenzio/ElasticSearchQuerier/client"
+)
+
+func runImport(args []string, stdout, stderr io.Writer) error {
+	cfg, err := loadConfig(args)
+	if err != nil {
+		return err
+	}
+	cfg.Mode = "import"
+
+	fs := newFlagSet("import", stderr)
+	connectionFlags(fs, cfg)
+	cfg.BindFlags(fs, "input", "report", "import-index", "batch-size", "metrics-addr", "trace-exporter", "otlp-endpoint")
+	if err := parseFlags(fs, args, cfg); err != nil {
+		return err
+	}
+
+	esClient, err := newESClient(cfg)
+	if err != nil {
+		return err
+	}
+	stopMetrics, err := serveMetrics(cfg)
+	if err != nil {
+		return err
+	}
+	defer stopMetrics()
+	stopTracing, err := startTracing(cfg)
+	if err != nil {
+		return err
+	}
+	defer stopTracing()
+
+	input, err := os.Open(cfg.InputPath)
+	if err != nil {
+		return configError(fmt.Errorf("failed to open import file: %w", err))
+	}
+	defer input.Close()
+
+	report, err := os.Create(cfg.ReportPath)
+	if err != nil {
+		return fmt.Errorf("failed to create failure report: %w", err)
+	}
+	defer report.Close()
+
+	importer := client.NewBulkImporter(esClient, cfg.ImportIndex, cfg.BatchSize)
+	importer.SetRetryPolicy(cfg.RetryPolicy())
+	start := time.Now()
+	stats, err := importer.Import(context.Background(), input, report)
+	if err != nil {
+		return fmt.Errorf("failed to import: %w", err)
+	}
+
+	slog.Info("Import finished", "input", cfg.InputPath, "docs", stats.Succeeded, "failed", stats.Failed,
+		"duration", time.Since(start))
+	if stats.Failed > 0 {
+		return fmt.Errorf("%d documents failed, see %s", stats.Failed, cfg.ReportPath)
+	}
+	return nil
+}
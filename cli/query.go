@@ -0,0 +1,138 @@
+// cli/query.go
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/terenzio/ElasticSearchQuerier/client"
+	"github.com/terenzio/ElasticSearchQuerier/querytemplate"
+)
+
+func runCount(args []string, stdout, stderr io.Writer) error {
+	cfg, err := loadConfig(args)
+	if err != nil {
+		return err
+	}
+	params := make(querytemplate.Values)
+
+	fs := newFlagSet("count", stderr)
+	connectionFlags(fs, cfg)
+	queryFlags(fs, cfg, params)
+	if err := parseFlags(fs, args, cfg); err != nil {
+		return err
+	}
+
+	esClient, err := newESClient(cfg)
+	if err != nil {
+		return err
+	}
+	query, err := loadQuery(cfg, params)
+	if err != nil {
+		return err
+	}
+
+	count, err := client.Count(context.Background(), esClient, cfg.RetryPolicy(), cfg.IndexName, query)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(stdout, count)
+	return nil
+}
+
+func runValidate(args []string, stdout, stderr io.Writer) error {
+	cfg, err := loadConfig(args)
+	if err != nil {
+		return err
+	}
+	params := make(querytemplate.Values)
+
+	fs := newFlagSet("validate", stderr)
+	connectionFlags(fs, cfg)
+	queryFlags(fs, cfg, params)
+	if err := parseFlags(fs, args, cfg); err != nil {
+		return err
+	}
+
+	esClient, err := newESClient(cfg)
+	if err != nil {
+		return err
+	}
+	query, err := loadQuery(cfg, params)
+	if err != nil {
+		return err
+	}
+
+	validation, err := client.ValidateQuery(context.Background(), esClient, cfg.RetryPolicy(), cfg.IndexName, query)
+	if err != nil {
+		return err
+	}
+	for _, e := range validation.Explanations {
+		switch {
+		case e.Error != "":
+			fmt.Fprintf(stdout, "%s: invalid: %s\n", e.Index, e.Error)
+		default:
+			fmt.Fprintf(stdout, "%s: valid: %s\n", e.Index, e.Explanation)
+		}
+	}
+	if !validation.Valid {
+		return &exitError{code: ExitQuery, err: fmt.Errorf("query is not valid")}
+	}
+	fmt.Fprintln(stdout, "query is valid")
+	return nil
+}
+
+func runMappings(args []string, stdout, stderr io.Writer) error {
+	cfg, err := loadConfig(args)
+	if err != nil {
+		return err
+	}
+
+	fs := newFlagSet("mappings", stderr)
+	connectionFlags(fs, cfg)
+	if err := parseFlags(fs, args, cfg); err != nil {
+		return err
+	}
+
+	esClient, err := newESClient(cfg)
+	if err != nil {
+		return err
+	}
+
+	properties, err := client.GetMapping(context.Background(), esClient, cfg.RetryPolicy(), cfg.IndexName)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(properties)
+}
+
+func runConfig(args []string, stdout, stderr io.Writer) error {
+	cfg, err := loadConfig(args)
+	if err != nil {
+		return err
+	}
+
+	fs := newFlagSet("config", stderr)
+	cfg.BindFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return usageError(err)
+	}
+
+	// Print before validating, so the output shows where a bad value came from.
+	if err := cfg.WriteYAML(stdout); err != nil {
+		return err
+	}
+	if err := cfg.Validate(); err != nil {
+		return configError(err)
+	}
+	return nil
+}
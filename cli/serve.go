@@ -0,0 +1,92 @@
+// cli/serve.go
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/terenzio/ElasticSearchQuerier/server"
+)
+
+// shutdownTimeout bounds how long serve waits for requests in flight when it
+// is stopped.
+const shutdownTimeout = 10 * time.Second
+
+func runServe(args []string, stdout, stderr io.Writer) error {
+	cfg, err := loadConfig(args)
+	if err != nil {
+		return err
+	}
+	cfg.Mode = "serve"
+
+	fs := newFlagSet("serve", stderr)
+	connectionFlags(fs, cfg)
+	cfg.BindFlags(fs, "listen", "serve-token-file", "jobs-dir", "job-workers", "job-queue", "job-retention",
+		"job-history", "batch-size", "scroll-duration", "pagination", "workers", "stream", "metadata",
+		"array-mode", "array-separator", "row-group-rows", "trace-exporter", "otlp-endpoint")
+	if err := parseFlags(fs, args, cfg); err != nil {
+		return err
+	}
+
+	token, err := cfg.ServeAuthToken()
+	if err != nil {
+		return configError(err)
+	}
+	esClient, err := newESClient(cfg)
+	if err != nil {
+		return err
+	}
+	stopTracing, err := startTracing(cfg)
+	if err != nil {
+		return err
+	}
+	defer stopTracing()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	manager, err := server.NewManager(ctx, esClient, cfg)
+	if err != nil {
+		return configError(err)
+	}
+
+	listener, err := net.Listen("tcp", cfg.ListenAddr)
+	if err != nil {
+		return configError(fmt.Errorf("failed to listen: %w", err))
+	}
+	httpServer := &http.Server{Handler: server.NewHandler(manager, token), ReadHeaderTimeout: 10 * time.Second}
+	served := make(chan error, 1)
+	go func() {
+		served <- httpServer.Serve(listener)
+	}()
+	slog.Info("Serving the jobs API", "url", "http://"+listener.Addr().String()+"/jobs",
+		"job_workers", cfg.JobWorkers, "authenticated", token != "")
+
+	// On SIGINT or SIGTERM stop taking requests and let the running jobs
+	// finish their page in hand; on a second signal abort them
+	stop := make(chan struct{})
+	defer handleSignals(func() { close(stop) }, manager.Abort)()
+
+	select {
+	case <-stop:
+	case err := <-served:
+		manager.Abort()
+		manager.Stop()
+		manager.Wait()
+		return fmt.Errorf("failed to serve: %w", err)
+	}
+
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancelShutdown()
+	if err := httpServer.Shutdown(shutdownCtx); err != nil && !errors.Is(err, context.DeadlineExceeded) {
+		slog.Warn("Failed to shut down the jobs API", "error", err)
+	}
+	manager.Stop()
+	manager.Wait()
+	return nil
+}
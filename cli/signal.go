@@ -0,0 +1,40 @@
+// cli/signal.go
+package cli
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// handleSignals stops a command gently on the first SIGINT or SIGTERM by
+// calling stop, and calls cancel to abort it on the second. The returned
+// function stops listening.
+func handleSignals(stop func(), cancel context.CancelFunc) func() {
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	done := make(chan struct{})
+
+	go func() {
+		select {
+		case sig := <-signals:
+			slog.Info("Stopping after the current page; repeat to abort", "signal", sig.String())
+			stop()
+		case <-done:
+			return
+		}
+		select {
+		case sig := <-signals:
+			slog.Info("Aborting", "signal", sig.String())
+			cancel()
+		case <-done:
+		}
+	}()
+
+	return func() {
+		signal.Stop(signals)
+		close(done)
+	}
+}
@@ -0,0 +1,282 @@
+// client/bulk.go
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/elastic/go-elasticsearch/v8"
+	"github.com/elastic/go-elasticsearch/v8/esapi"
+)
+
+// BulkImporter streams a _bulk NDJSON file, such as one written by the
+// "bulk" sink, into Elasticsearch in batches.
+type BulkImporter struct {
+	client      *elasticsearch.Client
+	indexName   string
+	batchSize   int
+	retryPolicy RetryPolicy
+}
+
+// NewBulkImporter returns an importer sending batchSize actions per request.
+// Actions keep the _index recorded in the file unless indexName is not
+// empty, in which case it replaces the _index of every action.
+func NewBulkImporter(client *elasticsearch.Client, indexName string, batchSize int) *BulkImporter {
+	if batchSize < 1 {
+		batchSize = 1
+	}
+	return &BulkImporter{
+		client:      client,
+		indexName:   indexName,
+		batchSize:   batchSize,
+		retryPolicy: DefaultRetryPolicy(),
+	}
+}
+
+// SetRetryPolicy sets how failed requests, and items rejected under load,
+// are retried. It defaults to DefaultRetryPolicy().
+func (b *BulkImporter) SetRetryPolicy(policy RetryPolicy) {
+	b.retryPolicy = policy
+}
+
+// BulkFailure is one action Elasticsearch did not apply.
+type BulkFailure struct {
+	Line   int             `json:"line"`
+	Action string          `json:"action"`
+	Index  string          `json:"_index,omitempty"`
+	ID     string          `json:"_id,omitempty"`
+	Status int             `json:"status"`
+	Error  json.RawMessage `json:"error,omitempty"`
+}
+
+// BulkStats counts the outcome of an import.
+type BulkStats struct {
+	Succeeded int
+	Failed    int
+}
+
+type bulkItem struct {
+	line   int
+	action string
+	meta   []byte
+	source []byte
+}
+
+type bulkItemResult struct {
+	Index  string          `json:"_index"`
+	ID     string          `json:"_id"`
+	Status int             `json:"status"`
+	Error  json.RawMessage `json:"error"`
+}
+
+// Import reads actions from r and sends them to the _bulk API. Requests that
+// fail as a whole are retried with backoff; items rejected with 429 are
+// resubmitted on their own with the same backoff. Items that still fail are
+// written to report as JSON lines and counted in the returned stats. An
+// error is returned only if the input is malformed or a request could not be
+// sent at all.
+func (b *BulkImporter) Import(ctx context.Context, r io.Reader, report io.Writer) (*BulkStats, error) {
+	reader := bufio.NewReader(r)
+	reportEnc := json.NewEncoder(report)
+	stats := &BulkStats{}
+	line := 0
+
+	for {
+		batch := make([]*bulkItem, 0, b.batchSize)
+		for len(batch) < b.batchSize {
+			item, err := b.readItem(reader, &line)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return stats, err
+			}
+			batch = append(batch, item)
+		}
+		if len(batch) == 0 {
+			return stats, nil
+		}
+
+		failures, err := b.send(ctx, batch)
+		if err != nil {
+			return stats, err
+		}
+		stats.Succeeded += len(batch) - len(failures)
+		stats.Failed += len(failures)
+		for _, failure := range failures {
+			if err := reportEnc.Encode(failure); err != nil {
+				return stats, fmt.Errorf("failed to write failure report: %w", err)
+			}
+		}
+	}
+}
+
+// readItem reads the next action and, unless it is a delete, its source line.
+func (b *BulkImporter) readItem(reader *bufio.Reader, line *int) (*bulkItem, error) {
+	meta, err := readNonEmptyLine(reader, line)
+	if err != nil {
+		return nil, err
+	}
+
+	var action map[string]map[string]interface{}
+	if err := json.Unmarshal(meta, &action); err != nil || len(action) != 1 {
+		return nil, fmt.Errorf("line %d: invalid bulk action", *line)
+	}
+	item := &bulkItem{line: *line}
+	for name, params := range action {
+		switch name {
+		case "index", "create", "update", "delete":
+		default:
+			return nil, fmt.Errorf("line %d: unknown bulk action %q", *line, name)
+		}
+		item.action = name
+		if b.indexName != "" {
+			if params == nil {
+				params = make(map[string]interface{})
+			}
+			params["_index"] = b.indexName
+			if meta, err = json.Marshal(map[string]interface{}{name: params}); err != nil {
+				return nil, fmt.Errorf("line %d: %w", *line, err)
+			}
+		}
+	}
+	item.meta = meta
+
+	if item.action != "delete" {
+		source, err := readNonEmptyLine(reader, line)
+		if err == io.EOF {
+			return nil, fmt.Errorf("line %d: %s action has no source line", item.line, item.action)
+		}
+		if err != nil {
+			return nil, err
+		}
+		item.source = source
+	}
+	return item, nil
+}
+
+func readNonEmptyLine(reader *bufio.Reader, line *int) ([]byte, error) {
+	for {
+		b, err := reader.ReadBytes('\n')
+		if len(b) > 0 {
+			*line++
+			if b = bytes.TrimSpace(b); len(b) > 0 {
+				return b, nil
+			}
+		}
+		if err != nil {
+			if err == io.EOF {
+				return nil, io.EOF
+			}
+			return nil, fmt.Errorf("failed to read bulk file: %w", err)
+		}
+	}
+}
+
+// send submits items and returns the ones that ultimately failed.
+func (b *BulkImporter) send(ctx context.Context, items []*bulkItem) ([]BulkFailure, error) {
+	var failures []BulkFailure
+	itemBackoff := backoff.WithContext(b.retryPolicy.newBackOff(), ctx)
+	itemBackoff.Reset()
+
+	for pending := items; len(pending) > 0; {
+		results, err := b.bulk(ctx, pending)
+		if err != nil {
+			return nil, err
+		}
+
+		var retry []*bulkItem
+		for i, result := range results {
+			switch {
+			case result.Status == http.StatusTooManyRequests:
+				retry = append(retry, pending[i])
+			case result.Status >= 300:
+				failures = append(failures, newBulkFailure(pending[i], result))
+			}
+		}
+
+		if len(retry) > 0 {
+			wait := itemBackoff.NextBackOff()
+			if wait == backoff.Stop {
+				for i, result := range results {
+					if result.Status == http.StatusTooManyRequests {
+						failures = append(failures, newBulkFailure(pending[i], result))
+					}
+				}
+				break
+			}
+			select {
+			case <-time.After(wait):
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+		pending = retry
+	}
+	return failures, nil
+}
+
+// bulk sends one _bulk request, retrying it as a whole with backoff, and
+// returns the per-item results in request order.
+func (b *BulkImporter) bulk(ctx context.Context, items []*bulkItem) ([]bulkItemResult, error) {
+	var body bytes.Buffer
+	for _, item := range items {
+		body.Write(item.meta)
+		body.WriteByte('\n')
+		if item.source != nil {
+			body.Write(item.source)
+			body.WriteByte('\n')
+		}
+	}
+
+	var res *esapi.Response
+	err := retry(ctx, b.retryPolicy, endpointBulk, func() error {
+		var err error
+		res, err = b.client.Bulk(
+			bytes.NewReader(body.Bytes()),
+			b.client.Bulk.WithContext(ctx),
+		)
+		return handleESResponse(res, err)
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("bulk request failed: %w", err)
+	}
+	defer res.Body.Close()
+
+	var response struct {
+		Items []map[string]bulkItemResult `json:"items"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("failed to parse bulk response: %w", err)
+	}
+	if len(response.Items) != len(items) {
+		return nil, fmt.Errorf("bulk response has %d items, expected %d", len(response.Items), len(items))
+	}
+
+	results := make([]bulkItemResult, len(items))
+	for i, item := range response.Items {
+		for _, result := range item {
+			results[i] = result
+		}
+	}
+	return results, nil
+}
+
+func newBulkFailure(item *bulkItem, result bulkItemResult) BulkFailure {
+	return BulkFailure{
+		Line:   item.line,
+		Action: item.action,
+		Index:  result.Index,
+		ID:     result.ID,
+		Status: result.Status,
+		Error:  result.Error,
+	}
+}
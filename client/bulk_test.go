@@ -0,0 +1,84 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/elastic/go-elasticsearch/v8"
+)
+
+func TestBulkImporterReportsFailedItems(t *testing.T) {
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Elastic-Product", "Elasticsearch")
+		w.Header().Set("Content-Type", "application/json")
+
+		// Answer every index action with 201, except the document with _id
+		// "bad", which is rejected as a mapping error.
+		var items []string
+		scanner := bufio.NewScanner(r.Body)
+		for scanner.Scan() {
+			line := scanner.Text()
+			requests = append(requests, line)
+			var action map[string]map[string]interface{}
+			if err := json.Unmarshal([]byte(line), &action); err != nil {
+				continue
+			}
+			meta, ok := action["index"]
+			if !ok {
+				continue
+			}
+			status := 201
+			errBody := ""
+			if meta["_id"] == "bad" {
+				status = 400
+				errBody = `,"error":{"type":"mapper_parsing_exception"}`
+			}
+			items = append(items, fmt.Sprintf(`{"index":{"_index":%q,"_id":%q,"status":%d%s}}`,
+				meta["_index"], meta["_id"], status, errBody))
+		}
+		fmt.Fprintf(w, `{"errors":true,"items":[%s]}`, strings.Join(items, ","))
+	}))
+	defer server.Close()
+
+	es, err := elasticsearch.NewClient(elasticsearch.Config{Addresses: []string{server.URL}})
+	if err != nil {
+		t.Fatalf("Error creating client: %s", err)
+	}
+
+	input := strings.Join([]string{
+		`{"index":{"_index":"old","_id":"1"}}`,
+		`{"title":"Document 1"}`,
+		``,
+		`{"index":{"_index":"old","_id":"bad"}}`,
+		`{"title":{"oops":true}}`,
+		`{"index":{"_index":"old","_id":"3"}}`,
+		`{"title":"Document 3"}`,
+	}, "\n")
+
+	var report bytes.Buffer
+	importer := NewBulkImporter(es, "new", 2)
+	stats, err := importer.Import(context.Background(), strings.NewReader(input), &report)
+	if err != nil {
+		t.Fatalf("Error importing: %s", err)
+	}
+
+	if stats.Succeeded != 2 || stats.Failed != 1 {
+		t.Errorf("Expected 2 succeeded and 1 failed but got %+v", stats)
+	}
+	if len(requests) != 6 || !strings.Contains(requests[0], `"_index":"new"`) {
+		t.Errorf("Expected 6 lines targeting index new but got %q", requests)
+	}
+
+	expected := `{"line":4,"action":"index","_index":"new","_id":"bad","status":400,"error":{"type":"mapper_parsing_exception"}}` + "\n"
+	if report.String() != expected {
+		t.Errorf("Expected report %q but got %q", expected, report.String())
+	}
+}
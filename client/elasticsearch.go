@@ -6,19 +6,30 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"log/slog"
 	"strings"
 	"time"
 
-	"github.com/cenkalti/backoff/v4"
 	"github.com/elastic/go-elasticsearch/v8"
 	"github.com/elastic/go-elasticsearch/v8/esapi"
 )
 
+// ESClient pages through an index with the scroll API. If the scroll
+// expires, it continues from the last hit in a point in time instead, as
+// long as the query has a stable sort; see checkRecoverable.
 type ESClient struct {
 	client         *elasticsearch.Client
 	scrollDuration time.Duration
 	batchSize      int
 	indexName      string
+
+	query       string
+	searchAfter []interface{}
+	decodeHit   hitDecoder
+	log         *slog.Logger
+	retryPolicy RetryPolicy
+	// fallback takes over the search once the scroll has been lost.
+	fallback *PITClient
 }
 
 func NewESClient(client *elasticsearch.Client, scrollDuration time.Duration, batchSize int, indexName string) *ESClient {
@@ -27,21 +38,35 @@ func NewESClient(client *elasticsearch.Client, scrollDuration time.Duration, bat
 		scrollDuration: scrollDuration,
 		batchSize:      batchSize,
 		indexName:      indexName,
+		retryPolicy:    DefaultRetryPolicy(),
 	}
 }
 
 type ScrollResult struct {
 	ScrollID string
-	Hits     []map[string]interface{}
+	Hits     []Hit
 	Total    int
+	// Streamed counts the hits passed to the HitHandler of a Streamer
+	// instead of being collected in Hits.
+	Streamed int
+	// SearchAfter holds the sort values of the last hit on the page, if the
+	// search was sorted. The point-in-time engine resumes from it.
+	SearchAfter []interface{}
+	// Malformed holds the hits of the page that could not be parsed.
+	Malformed []MalformedHit
+	// Recovered is set if the search context had expired and was
+	// re-established to fetch this page.
+	Recovered bool
 }
 
 // func (c *ESClient) InitialSearch(ctx context.Context, query []byte) (*ScrollResult, error) {
 func (c *ESClient) InitialSearch(ctx context.Context, query string) (*ScrollResult, error) {
-	backoffConfig := newBackoffConfig()
+	c.query = query
+	c.searchAfter = nil
+	c.fallback = nil
 
 	var res *esapi.Response
-	err := backoff.Retry(func() error {
+	err := retry(ctx, c.retryPolicy, endpointSearch, func() error {
 		var err error
 		res, err = c.client.Search(
 			c.client.Search.WithContext(ctx),
@@ -51,23 +76,56 @@ func (c *ESClient) InitialSearch(ctx context.Context, query string) (*ScrollResu
 			c.client.Search.WithSize(c.batchSize),
 			c.client.Search.WithScroll(c.scrollDuration),
 			c.client.Search.WithTrackTotalHits(true),
+			c.client.Search.WithSeqNoPrimaryTerm(true),
 		)
 		return handleESResponse(res, err)
-	}, backoffConfig)
+	})
 
 	if err != nil {
 		return nil, fmt.Errorf("initial search failed: %w", err)
 	}
 	defer res.Body.Close()
 
-	return parseScrollResponse(res.Body)
+	return c.track(parseScrollResponse(res.Body, c.decodeHit))
+}
+
+// Stream makes later pages pass their hits to handle as they are decoded.
+func (c *ESClient) Stream(handle HitHandler) {
+	c.decodeHit = streamHits(handle)
+}
+
+func (c *ESClient) setHitDecoder(decodeHit hitDecoder) {
+	c.decodeHit = decodeHit
+}
+
+// SetLogger sets where the client logs. It defaults to slog.Default().
+func (c *ESClient) SetLogger(logger *slog.Logger) {
+	c.log = logger
+}
+
+// SetRetryPolicy sets how failed requests are retried. It defaults to
+// DefaultRetryPolicy().
+func (c *ESClient) SetRetryPolicy(policy RetryPolicy) {
+	c.retryPolicy = policy
 }
 
+func (c *ESClient) logger() *slog.Logger {
+	if c.log == nil {
+		return slog.Default()
+	}
+	return c.log
+}
+
+// Scroll fetches the next page. If the scroll has expired, the search is
+// re-established from the last hit and the returned ScrollID is that of the
+// point in time it continues in.
 func (c *ESClient) Scroll(ctx context.Context, scrollID string) (*ScrollResult, error) {
-	backoffConfig := newBackoffConfig()
+	if c.fallback != nil {
+		return c.fallback.Scroll(ctx, scrollID)
+	}
 
 	var res *esapi.Response
-	err := backoff.Retry(func() error {
+	err := retry(ctx, c.retryPolicy, endpointScroll, func() error {
 		var err error
 		res, err = c.client.Scroll(
 			c.client.Scroll.WithContext(ctx),
@@ -75,66 +133,85 @@ func (c *ESClient) Scroll(ctx context.Context, scrollID string) (*ScrollResult,
 			c.client.Scroll.WithScroll(c.scrollDuration),
 		)
 		return handleESResponse(res, err)
-	}, backoffConfig)
+	})
 
+	if isContextLost(err) {
+		return c.recover(ctx, err)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("scroll request failed: %w", err)
 	}
 	defer res.Body.Close()
 
-	return parseScrollResponse(res.Body)
+	return c.track(parseScrollResponse(res.Body, c.decodeHit))
+}
+
+// track remembers the position of the last page for recovery.
+func (c *ESClient) track(result *ScrollResult, err error) (*ScrollResult, error) {
+	if err == nil && result.SearchAfter != nil {
+		c.searchAfter = result.SearchAfter
+	}
+	return result, err
+}
+
+// recover continues the search after the last hit in a new point in time.
+func (c *ESClient) recover(ctx context.Context, lost error) (*ScrollResult, error) {
+	var query map[string]interface{}
+	if err := json.Unmarshal([]byte(c.query), &query); err != nil {
+		return nil, fmt.Errorf("failed to parse query: %w", err)
+	}
+	if err := checkRecoverable(query["sort"], c.searchAfter); err != nil {
+		return nil, fmt.Errorf("scroll request failed: %w: %w", err, lost)
+	}
+
+	c.logger().Warn("Scroll has expired, continuing after the last hit in a point in time",
+		"error", lost)
+	fallback := NewPITClient(c.client, c.scrollDuration, c.batchSize, c.indexName)
+	fallback.setHitDecoder(c.decodeHit)
+	fallback.SetLogger(c.log)
+	fallback.SetRetryPolicy(c.retryPolicy)
+	result, err := fallback.Resume(ctx, c.query, "", c.searchAfter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to re-establish expired scroll: %w", err)
+	}
+	c.fallback = fallback
+	result.Recovered = true
+	return result, nil
 }
 
+// ClearScroll releases the scroll, or the point in time that replaced it.
 func (c *ESClient) ClearScroll(ctx context.Context, scrollID string) error {
+	if c.fallback != nil {
+		return c.fallback.ClearScroll(ctx, scrollID)
+	}
+	start := time.Now()
 	_, err := c.client.ClearScroll(
 		c.client.ClearScroll.WithContext(ctx),
 		c.client.ClearScroll.WithScrollID(scrollID),
 	)
+	observeRequest(endpointClearScroll, start, err)
 	return err
 }
 
-func newBackoffConfig() *backoff.ExponentialBackOff {
-	b := backoff.NewExponentialBackOff()
-	b.InitialInterval = 1 * time.Second
-	b.MaxInterval = 30 * time.Second
-	b.MaxElapsedTime = 5 * time.Minute
-	return b
+func parseScrollResponse(body io.Reader, decodeHit hitDecoder) (*ScrollResult, error) {
+	result, err := decodeSearchResponse(body, "_scroll_id", decodeHit)
+	observePage(result, err)
+	return result, err
 }
 
-func handleESResponse(res *esapi.Response, err error) error {
-	if err != nil {
-		return fmt.Errorf("elasticsearch request failed: %w", err)
-	}
-	if res.IsError() {
-		return fmt.Errorf("elasticsearch response error: %s", res.String())
-	}
-	return nil
+// newDecoder returns a decoder for a response body. It keeps numbers as
+// json.Number so large integers in _source and sort values survive the
+// round trip unchanged.
+func newDecoder(body io.Reader) *json.Decoder {
+	dec := json.NewDecoder(body)
+	dec.UseNumber()
+	return dec
 }
 
-func parseScrollResponse(body io.Reader) (*ScrollResult, error) {
+func decodeResponse(body io.Reader) (map[string]interface{}, error) {
 	var result map[string]interface{}
-	if err := json.NewDecoder(body).Decode(&result); err != nil {
+	if err := newDecoder(body).Decode(&result); err != nil {
 		return nil, fmt.Errorf("failed to parse response: %w", err)
 	}
-
-	scrollID, ok := result["_scroll_id"].(string)
-	if !ok {
-		return nil, fmt.Errorf("scroll ID not found in response")
-	}
-
-	hitsObj := result["hits"].(map[string]interface{})
-	total := int(hitsObj["total"].(map[string]interface{})["value"].(float64))
-	hits := hitsObj["hits"].([]interface{})
-
-	processedHits := make([]map[string]interface{}, len(hits))
-	for i, hit := range hits {
-		hitMap := hit.(map[string]interface{})
-		processedHits[i] = hitMap["_source"].(map[string]interface{})
-	}
-
-	return &ScrollResult{
-		ScrollID: scrollID,
-		Hits:     processedHits,
-		Total:    total,
-	}, nil
+	return result, nil
 }
@@ -0,0 +1,87 @@
+// client/hit.go
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Hit is a single search hit: the document _source together with the
+// metadata Elasticsearch returned for it. Optional fields are nil or empty
+// when the response did not include them.
+type Hit struct {
+	ID          string                 `json:"_id"`
+	Index       string                 `json:"_index"`
+	Routing     string                 `json:"_routing,omitempty"`
+	Score       *float64               `json:"_score,omitempty"`
+	SeqNo       *int64                 `json:"_seq_no,omitempty"`
+	PrimaryTerm *int64                 `json:"_primary_term,omitempty"`
+	Sort        []interface{}          `json:"sort,omitempty"`
+	Highlight   map[string]interface{} `json:"highlight,omitempty"`
+	Source      map[string]interface{} `json:"_source"`
+}
+
+// newHit converts a decoded hit. A hit without _source, as returned when
+// _source is disabled or filtered out, is valid and has a nil Source; a hit
+// that is not an object, has no _id or has fields of the wrong type is
+// reported with an error wrapping ErrMalformedHit.
+func newHit(raw interface{}) (Hit, error) {
+	hitMap, ok := raw.(map[string]interface{})
+	if !ok {
+		return Hit{}, fmt.Errorf("%w: not an object", ErrMalformedHit)
+	}
+
+	hit := Hit{}
+	if hit.ID, ok = hitMap["_id"].(string); !ok {
+		return Hit{}, fmt.Errorf("%w: missing _id", ErrMalformedHit)
+	}
+	for _, field := range []struct {
+		name string
+		ok   bool
+	}{
+		{"_index", optional(hitMap, "_index", &hit.Index)},
+		{"_routing", optional(hitMap, "_routing", &hit.Routing)},
+		{"_source", optional(hitMap, "_source", &hit.Source)},
+		{"sort", optional(hitMap, "sort", &hit.Sort)},
+		{"highlight", optional(hitMap, "highlight", &hit.Highlight)},
+	} {
+		if !field.ok {
+			return Hit{}, fmt.Errorf("%w: %s of document %s has the wrong type", ErrMalformedHit, field.name, hit.ID)
+		}
+	}
+
+	if score, ok := hitMap["_score"].(json.Number); ok {
+		if f, err := score.Float64(); err == nil {
+			hit.Score = &f
+		}
+	}
+	hit.SeqNo = int64Field(hitMap, "_seq_no")
+	hit.PrimaryTerm = int64Field(hitMap, "_primary_term")
+	return hit, nil
+}
+
+// optional stores m[key] in dst if it has dst's type. It reports false only
+// if the key is present, not null and of another type.
+func optional[T any](m map[string]interface{}, key string, dst *T) bool {
+	v, present := m[key]
+	if !present || v == nil {
+		return true
+	}
+	value, ok := v.(T)
+	if ok {
+		*dst = value
+	}
+	return ok
+}
+
+func int64Field(m map[string]interface{}, key string) *int64 {
+	number, ok := m[key].(json.Number)
+	if !ok {
+		return nil
+	}
+	n, err := number.Int64()
+	if err != nil {
+		return nil
+	}
+	return &n
+}
@@ -0,0 +1,57 @@
+// client/mapping.go
+package client
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/elastic/go-elasticsearch/v8"
+	"github.com/elastic/go-elasticsearch/v8/esapi"
+)
+
+// GetMapping returns the "properties" of the mapping of indexName. If
+// indexName matches several indices their properties are merged; where two
+// indices define the same field, the index whose name sorts first wins, so
+// the result does not change from one call to the next. Failed requests are
+// retried with policy.
+func GetMapping(ctx context.Context, client *elasticsearch.Client, policy RetryPolicy, indexName string) (map[string]interface{}, error) {
+	var res *esapi.Response
+	err := retry(ctx, policy, endpointMapping, func() error {
+		var err error
+		res, err = client.Indices.GetMapping(
+			client.Indices.GetMapping.WithContext(ctx),
+			client.Indices.GetMapping.WithIndex(indexName),
+		)
+		return handleESResponse(res, err)
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("get mapping failed: %w", err)
+	}
+	defer res.Body.Close()
+
+	result, err := decodeResponse(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(result))
+	for name := range result {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	properties := make(map[string]interface{})
+	for _, index := range names {
+		indexMap, _ := result[index].(map[string]interface{})
+		mappings, _ := indexMap["mappings"].(map[string]interface{})
+		props, _ := mappings["properties"].(map[string]interface{})
+		for name, prop := range props {
+			if _, ok := properties[name]; !ok {
+				properties[name] = prop
+			}
+		}
+	}
+	return properties, nil
+}
@@ -0,0 +1,41 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/elastic/go-elasticsearch/v8"
+)
+
+func TestGetMappingMergesIndicesInNameOrder(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Elastic-Product", "Elasticsearch")
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{
+			"logs-c": {"mappings": {"properties": {"status": {"type": "keyword"}, "bytes": {"type": "integer"}}}},
+			"logs-a": {"mappings": {"properties": {"status": {"type": "long"}}}},
+			"logs-b": {"mappings": {"properties": {"status": {"type": "text"}, "host": {"type": "keyword"}}}}
+		}`)
+	}))
+	defer server.Close()
+
+	es, err := elasticsearch.NewClient(elasticsearch.Config{Addresses: []string{server.URL}})
+	if err != nil {
+		t.Fatalf("Error creating client: %s", err)
+	}
+
+	// Map iteration is random, so repeat to catch an order-dependent merge
+	for i := 0; i < 20; i++ {
+		properties, err := GetMapping(context.Background(), es, DefaultRetryPolicy(), "logs-*")
+		if err != nil {
+			t.Fatalf("Error getting mapping: %s", err)
+		}
+		expected := "map[bytes:map[type:integer] host:map[type:keyword] status:map[type:long]]"
+		if got := fmt.Sprint(properties); got != expected {
+			t.Fatalf("Expected %s but got %s", expected, got)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+// client/metrics.go
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"time"
+
+	"github.com/terenzio/ElasticSearchQuerier/metrics"
+)
+
+// Endpoints, the values of the "endpoint" label of the request metrics.
+const (
+	endpointSearch      = "search"
+	endpointScroll      = "scroll"
+	endpointClearScroll = "clear_scroll"
+	endpointOpenPIT     = "open_pit"
+	endpointClosePIT    = "close_pit"
+	endpointCount       = "count"
+	endpointValidate    = "validate_query"
+	endpointMapping     = "mapping"
+	endpointBulk        = "bulk"
+)
+
+// observeRequest records a request to endpoint sent at start that ended
+// with err.
+func observeRequest(endpoint string, start time.Time, err error) {
+	metrics.RequestDuration.WithLabelValues(endpoint).Observe(time.Since(start).Seconds())
+	countError(err)
+}
+
+// observePage records a decoded search response.
+func observePage(result *ScrollResult, err error) {
+	if err != nil {
+		countError(err)
+		return
+	}
+	metrics.Pages.Inc()
+	metrics.DocumentsFetched.Add(float64(result.Len()))
+	if len(result.Malformed) > 0 {
+		metrics.Errors.WithLabelValues(metrics.ClassMalformedHit).Add(float64(len(result.Malformed)))
+	}
+}
+
+// countError counts err under its class. Cancellation is not counted.
+func countError(err error) {
+	if class := errorClass(err); class != "" {
+		metrics.Errors.WithLabelValues(class).Inc()
+	}
+}
+
+// errorClass returns the metrics class of err, or "" for no error, a
+// cancelled request and errors that did not come from Elasticsearch, such
+// as those of a HitHandler.
+func errorClass(err error) string {
+	var (
+		respErr    *ResponseError
+		netErr     net.Error
+		shardError *ShardFailureError
+		syntaxErr  *json.SyntaxError
+	)
+	switch {
+	case err == nil || errors.Is(err, context.Canceled):
+		return ""
+	case isContextLost(err):
+		return metrics.ClassContextLost
+	case errors.As(err, &respErr):
+		switch {
+		case respErr.StatusCode == 429 || respErr.Type == "es_rejected_execution_exception" ||
+			respErr.Type == "circuit_breaking_exception":
+			return metrics.ClassRejected
+		case IsRetryable(err):
+			return metrics.ClassUnavailable
+		}
+		return metrics.ClassResponse
+	case errors.Is(err, context.DeadlineExceeded) || errors.As(err, &netErr) && netErr.Timeout():
+		return metrics.ClassTimeout
+	case errors.Is(err, ErrRequestFailed):
+		return metrics.ClassConnection
+	case errors.As(err, &shardError):
+		return metrics.ClassShardFailure
+	case errors.Is(err, ErrMalformedHit):
+		return metrics.ClassMalformedHit
+	case errors.Is(err, ErrMalformedResponse) || errors.Is(err, ErrMissingScrollID) ||
+		errors.As(err, &syntaxErr) || errors.Is(err, io.ErrUnexpectedEOF):
+		return metrics.ClassMalformedResponse
+	}
+	return ""
+}
@@ -0,0 +1,40 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/terenzio/ElasticSearchQuerier/metrics"
+)
+
+func TestErrorClass(t *testing.T) {
+	contextMissing := &ResponseError{StatusCode: 404, Type: "search_phase_execution_exception",
+		Response: `[404 Not Found] {"error":{"root_cause":[{"type":"search_context_missing_exception"}]}}`}
+	tests := []struct {
+		err      error
+		expected string
+	}{
+		{nil, ""},
+		{&ResponseError{StatusCode: 429}, metrics.ClassRejected},
+		{&ResponseError{StatusCode: 500, Type: "circuit_breaking_exception"}, metrics.ClassRejected},
+		{&ResponseError{StatusCode: 503}, metrics.ClassUnavailable},
+		{&ResponseError{StatusCode: 400, Type: "parsing_exception"}, metrics.ClassResponse},
+		{fmt.Errorf("scroll request failed: %w", contextMissing), metrics.ClassContextLost},
+		{fmt.Errorf("%w: %w", ErrRequestFailed, errors.New("connection refused")), metrics.ClassConnection},
+		{fmt.Errorf("%w: %w", ErrRequestFailed, context.DeadlineExceeded), metrics.ClassTimeout},
+		{fmt.Errorf("%w: %w", ErrRequestFailed, context.Canceled), ""},
+		{&ShardFailureError{Total: 2, Failed: 1}, metrics.ClassShardFailure},
+		{fmt.Errorf("%w: missing _id", ErrMalformedHit), metrics.ClassMalformedHit},
+		{fmt.Errorf("failed to parse response: %w", &json.SyntaxError{}), metrics.ClassMalformedResponse},
+		{ErrMissingScrollID, metrics.ClassMalformedResponse},
+		{errors.New("failed to process hits: disk full"), ""},
+	}
+	for _, test := range tests {
+		if got := errorClass(test.err); got != test.expected {
+			t.Errorf("Expected class %q for %v but got %q", test.expected, test.err, got)
+		}
+	}
+}
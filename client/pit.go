@@ -0,0 +1,277 @@
+// client/pit.go
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v8"
+	"github.com/elastic/go-elasticsearch/v8/esapi"
+)
+
+// PITClient pages through an index with a point in time and search_after
+// instead of the scroll API. It exposes the same InitialSearch/Scroll/
+// ClearScroll surface as ESClient; the "scroll ID" it hands back is the
+// point-in-time ID.
+//
+// A PITClient keeps the query and the last sort values between calls, so a
+// single instance drives a single export.
+type PITClient struct {
+	client    *elasticsearch.Client
+	keepAlive time.Duration
+	batchSize int
+	indexName string
+
+	query       map[string]interface{}
+	searchAfter []interface{}
+	decodeHit   hitDecoder
+	log         *slog.Logger
+	retryPolicy RetryPolicy
+}
+
+func NewPITClient(client *elasticsearch.Client, keepAlive time.Duration, batchSize int, indexName string) *PITClient {
+	return &PITClient{
+		client:      client,
+		keepAlive:   keepAlive,
+		batchSize:   batchSize,
+		indexName:   indexName,
+		retryPolicy: DefaultRetryPolicy(),
+	}
+}
+
+// InitialSearch opens a point in time on the index and fetches the first page.
+// If the query has no sort, results are sorted on the _shard_doc tiebreaker.
+func (c *PITClient) InitialSearch(ctx context.Context, query string) (*ScrollResult, error) {
+	if err := c.setQuery(query); err != nil {
+		return nil, err
+	}
+	c.searchAfter = nil
+
+	pitID, err := c.openPointInTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := c.search(ctx, pitID, true)
+	if err != nil {
+		// The caller never learns the ID, so release the point in time here
+		c.ClearScroll(ctx, pitID)
+		return nil, fmt.Errorf("initial search failed: %w", err)
+	}
+	return result, nil
+}
+
+// Resume continues a search after the hit with sort values searchAfter. It
+// reuses the point in time pitID if it is still open, and otherwise opens a
+// new one, which requires a stable sort; see checkRecoverable.
+func (c *PITClient) Resume(ctx context.Context, query, pitID string, searchAfter []interface{}) (*ScrollResult, error) {
+	if err := c.setQuery(query); err != nil {
+		return nil, err
+	}
+	c.searchAfter = searchAfter
+
+	if pitID != "" {
+		result, err := c.search(ctx, pitID, true)
+		if err == nil {
+			return result, nil
+		}
+		if !isContextLost(err) {
+			return nil, fmt.Errorf("resumed search failed: %w", err)
+		}
+		return c.recover(ctx, err)
+	}
+
+	pitID, err := c.openPointInTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+	result, err := c.search(ctx, pitID, true)
+	if err != nil {
+		return nil, fmt.Errorf("resumed search failed: %w", err)
+	}
+	return result, nil
+}
+
+// Scroll fetches the page following the last hit returned so far. If the
+// point in time has expired, the search continues in a new one and the
+// returned ScrollID changes accordingly.
+func (c *PITClient) Scroll(ctx context.Context, pitID string) (*ScrollResult, error) {
+	result, err := c.search(ctx, pitID, false)
+	if isContextLost(err) {
+		return c.recover(ctx, err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("search_after request failed: %w", err)
+	}
+	return result, nil
+}
+
+// recover continues the search after the last hit in a new point in time.
+func (c *PITClient) recover(ctx context.Context, lost error) (*ScrollResult, error) {
+	if err := checkRecoverable(c.query["sort"], c.searchAfter); err != nil {
+		return nil, fmt.Errorf("search_after request failed: %w: %w", err, lost)
+	}
+
+	c.logger().Warn("Point in time has expired, continuing after the last hit in a new one",
+		"error", lost)
+	pitID, err := c.openPointInTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+	result, err := c.search(ctx, pitID, true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to re-establish expired point in time: %w", err)
+	}
+	result.Recovered = true
+	return result, nil
+}
+
+// Stream makes later pages pass their hits to handle as they are decoded.
+func (c *PITClient) Stream(handle HitHandler) {
+	c.decodeHit = streamHits(handle)
+}
+
+func (c *PITClient) setHitDecoder(decodeHit hitDecoder) {
+	c.decodeHit = decodeHit
+}
+
+// SetLogger sets where the client logs. It defaults to slog.Default().
+func (c *PITClient) SetLogger(logger *slog.Logger) {
+	c.log = logger
+}
+
+// SetRetryPolicy sets how failed requests are retried. It defaults to
+// DefaultRetryPolicy().
+func (c *PITClient) SetRetryPolicy(policy RetryPolicy) {
+	c.retryPolicy = policy
+}
+
+func (c *PITClient) logger() *slog.Logger {
+	if c.log == nil {
+		return slog.Default()
+	}
+	return c.log
+}
+
+// ClearScroll closes the point in time.
+func (c *PITClient) ClearScroll(ctx context.Context, pitID string) error {
+	body, err := json.Marshal(map[string]string{"id": pitID})
+	if err != nil {
+		return err
+	}
+
+	start := time.Now()
+	res, err := c.client.ClosePointInTime(
+		c.client.ClosePointInTime.WithContext(ctx),
+		c.client.ClosePointInTime.WithBody(bytes.NewReader(body)),
+	)
+	err = handleESResponse(res, err)
+	observeRequest(endpointClosePIT, start, err)
+	if err != nil {
+		return err
+	}
+	return res.Body.Close()
+}
+
+func (c *PITClient) setQuery(query string) error {
+	if err := json.Unmarshal([]byte(query), &c.query); err != nil {
+		return fmt.Errorf("failed to parse query: %w", err)
+	}
+	if _, ok := c.query["sort"]; !ok {
+		c.query["sort"] = []interface{}{"_shard_doc"}
+	}
+	return nil
+}
+
+func (c *PITClient) openPointInTime(ctx context.Context) (string, error) {
+	var res *esapi.Response
+	err := retry(ctx, c.retryPolicy, endpointOpenPIT, func() error {
+		var err error
+		res, err = c.client.OpenPointInTime(
+			[]string{c.indexName},
+			formatKeepAlive(c.keepAlive),
+			c.client.OpenPointInTime.WithContext(ctx),
+		)
+		return handleESResponse(res, err)
+	})
+
+	if err != nil {
+		return "", fmt.Errorf("open point in time failed: %w", err)
+	}
+	defer res.Body.Close()
+
+	result, err := decodeResponse(res.Body)
+	if err != nil {
+		return "", err
+	}
+	pitID, ok := result["id"].(string)
+	if !ok {
+		return "", fmt.Errorf("point in time ID not found in response")
+	}
+	return pitID, nil
+}
+
+func (c *PITClient) search(ctx context.Context, pitID string, trackTotalHits bool) (*ScrollResult, error) {
+	body := make(map[string]interface{}, len(c.query)+4)
+	for k, v := range c.query {
+		body[k] = v
+	}
+	body["size"] = c.batchSize
+	body["pit"] = map[string]interface{}{
+		"id":         pitID,
+		"keep_alive": formatKeepAlive(c.keepAlive),
+	}
+	body["track_total_hits"] = trackTotalHits
+	body["seq_no_primary_term"] = true
+	if c.searchAfter != nil {
+		body["search_after"] = c.searchAfter
+	}
+
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode query: %w", err)
+	}
+
+	var res *esapi.Response
+	err = retry(ctx, c.retryPolicy, endpointSearch, func() error {
+		var err error
+		// The index is implied by the point in time and must not be set.
+		res, err = c.client.Search(
+			c.client.Search.WithContext(ctx),
+			c.client.Search.WithBody(strings.NewReader(string(payload))),
+		)
+		return handleESResponse(res, err)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	result, err := parsePITResponse(res.Body, c.decodeHit)
+	if err != nil {
+		return nil, err
+	}
+	if result.SearchAfter != nil {
+		c.searchAfter = result.SearchAfter
+	}
+	return result, nil
+}
+
+func parsePITResponse(body io.Reader, decodeHit hitDecoder) (*ScrollResult, error) {
+	result, err := decodeSearchResponse(body, "pit_id", decodeHit)
+	observePage(result, err)
+	return result, err
+}
+
+// formatKeepAlive renders d in the time unit syntax Elasticsearch expects.
+func formatKeepAlive(d time.Duration) string {
+	return strconv.FormatInt(d.Milliseconds(), 10) + "ms"
+}
@@ -0,0 +1,157 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v8"
+)
+
+// fakePIT serves the point-in-time APIs over five documents sorted on "n",
+// handing out a new pit_id with every page as Elasticsearch may.
+type fakePIT struct {
+	// searchIDs and searchAfters record the pit.id and search_after of each
+	// search; closed the IDs of the points in time closed.
+	searchIDs    []string
+	searchAfters [][]interface{}
+	closed       []string
+	// failSearch makes searches answer without a pit_id.
+	failSearch bool
+}
+
+func (f *fakePIT) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("X-Elastic-Product", "Elasticsearch")
+	w.Header().Set("Content-Type", "application/json")
+
+	var body struct {
+		ID  string `json:"id"`
+		PIT struct {
+			ID string `json:"id"`
+		} `json:"pit"`
+		SearchAfter []interface{} `json:"search_after"`
+		Size        int           `json:"size"`
+	}
+	json.NewDecoder(r.Body).Decode(&body)
+
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == "/logs/_pit":
+		fmt.Fprint(w, `{"id":"pit-0"}`)
+	case r.Method == http.MethodDelete && r.URL.Path == "/_pit":
+		f.closed = append(f.closed, body.ID)
+		fmt.Fprint(w, `{"succeeded":true,"num_freed":1}`)
+	case r.URL.Path == "/_search":
+		f.searchIDs = append(f.searchIDs, body.PIT.ID)
+		f.searchAfters = append(f.searchAfters, body.SearchAfter)
+		if f.failSearch {
+			fmt.Fprint(w, `{}`)
+			return
+		}
+		from := 1
+		if body.SearchAfter != nil {
+			from = int(body.SearchAfter[0].(float64)) + 1
+		}
+		hits := []map[string]interface{}{}
+		for n := from; n <= 5 && len(hits) < body.Size; n++ {
+			hits = append(hits, map[string]interface{}{
+				"_id": fmt.Sprint(n), "_source": map[string]interface{}{"n": n}, "sort": []interface{}{n},
+			})
+		}
+		// The total is only counted on the first page
+		page := map[string]interface{}{"hits": hits}
+		if body.SearchAfter == nil {
+			page["total"] = map[string]interface{}{"value": 5, "relation": "eq"}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"pit_id": fmt.Sprintf("pit-%d", len(f.searchIDs)),
+			"hits":   page,
+		})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func newFakePIT(t *testing.T, fake *fakePIT) *elasticsearch.Client {
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	es, err := elasticsearch.NewClient(elasticsearch.Config{Addresses: []string{server.URL}})
+	if err != nil {
+		t.Fatalf("Error creating client: %s", err)
+	}
+	return es
+}
+
+func TestPITClientPagesWithSearchAfter(t *testing.T) {
+	fake := &fakePIT{}
+	c := NewPITClient(newFakePIT(t, fake), time.Minute, 2, "logs")
+	ctx := context.Background()
+
+	result, err := c.InitialSearch(ctx, `{"query":{"match_all":{}},"sort":[{"n":"asc"}]}`)
+	if err != nil {
+		t.Fatalf("Error in initial search: %s", err)
+	}
+	if result.Total != 5 {
+		t.Errorf("Expected a total of 5 but got %d", result.Total)
+	}
+	var docs []interface{}
+	for len(result.Hits) > 0 {
+		for _, hit := range result.Hits {
+			docs = append(docs, hit.Source["n"])
+		}
+		if result, err = c.Scroll(ctx, result.ScrollID); err != nil {
+			t.Fatalf("Error scrolling: %s", err)
+		}
+	}
+	if err := c.ClearScroll(ctx, result.ScrollID); err != nil {
+		t.Fatalf("Error closing point in time: %s", err)
+	}
+
+	if fmt.Sprint(docs) != "[1 2 3 4 5]" {
+		t.Errorf("Expected documents 1 to 5 in order but got %v", docs)
+	}
+	// Each search must use the pit_id returned by the one before
+	if expected := "[pit-0 pit-1 pit-2 pit-3]"; fmt.Sprint(fake.searchIDs) != expected {
+		t.Errorf("Expected searches in %s but got %v", expected, fake.searchIDs)
+	}
+	if expected := "[[] [2] [4] [5]]"; fmt.Sprint(fake.searchAfters) != expected {
+		t.Errorf("Expected search_after %s but got %v", expected, fake.searchAfters)
+	}
+	if fmt.Sprint(fake.closed) != "[pit-4]" {
+		t.Errorf("Expected the last point in time to be closed but got %v", fake.closed)
+	}
+}
+
+func TestPITClientClosesPointInTimeOnError(t *testing.T) {
+	fake := &fakePIT{failSearch: true}
+	c := NewPITClient(newFakePIT(t, fake), time.Minute, 2, "logs")
+
+	if _, err := c.InitialSearch(context.Background(), `{"query":{"match_all":{}}}`); err == nil {
+		t.Fatalf("Expected the initial search to fail")
+	}
+	if fmt.Sprint(fake.closed) != "[pit-0]" {
+		t.Errorf("Expected the point in time to be closed but got %v", fake.closed)
+	}
+}
+
+func TestNewSearcher(t *testing.T) {
+	es, err := elasticsearch.NewDefaultClient()
+	if err != nil {
+		t.Fatalf("Error creating client: %s", err)
+	}
+	for mode, expected := range map[string]string{"": "*client.ESClient", ModeScroll: "*client.ESClient", ModePIT: "*client.PITClient"} {
+		searcher, err := NewSearcher(mode, es, time.Minute, 10, "logs")
+		if err != nil {
+			t.Fatalf("Error creating searcher for mode %q: %s", mode, err)
+		}
+		if got := fmt.Sprintf("%T", searcher); got != expected {
+			t.Errorf("Expected %s for mode %q but got %s", expected, mode, got)
+		}
+	}
+	if _, err := NewSearcher("cursor", es, time.Minute, 10, "logs"); err == nil {
+		t.Errorf("Expected an error for an unknown mode")
+	}
+}
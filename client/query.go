@@ -0,0 +1,110 @@
+// client/query.go
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/elastic/go-elasticsearch/v8"
+	"github.com/elastic/go-elasticsearch/v8/esapi"
+)
+
+// Count returns the number of documents in indexName matching query. Only
+// the "query" clause of query is used; size, sort and the like are dropped
+// since the _count API rejects them. Failed requests are retried with policy.
+func Count(ctx context.Context, client *elasticsearch.Client, policy RetryPolicy, indexName, query string) (int, error) {
+	body, err := queryClause(query)
+	if err != nil {
+		return 0, err
+	}
+
+	var res *esapi.Response
+	err = retry(ctx, policy, endpointCount, func() error {
+		var err error
+		res, err = client.Count(
+			client.Count.WithContext(ctx),
+			client.Count.WithIndex(indexName),
+			client.Count.WithBody(strings.NewReader(body)),
+		)
+		return handleESResponse(res, err)
+	})
+
+	if err != nil {
+		return 0, fmt.Errorf("count failed: %w", err)
+	}
+	defer res.Body.Close()
+
+	var result struct {
+		Count int `json:"count"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&result); err != nil {
+		return 0, fmt.Errorf("failed to parse response: %w", err)
+	}
+	return result.Count, nil
+}
+
+// Validation is the outcome of validating a query.
+type Validation struct {
+	Valid        bool                    `json:"valid"`
+	Explanations []ValidationExplanation `json:"explanations"`
+}
+
+// ValidationExplanation is the per-index detail of a Validation.
+type ValidationExplanation struct {
+	Index       string `json:"index"`
+	Valid       bool   `json:"valid"`
+	Error       string `json:"error,omitempty"`
+	Explanation string `json:"explanation,omitempty"`
+}
+
+// ValidateQuery asks Elasticsearch whether the "query" clause of query is
+// valid against indexName, with an explanation per index. Failed requests
+// are retried with policy.
+func ValidateQuery(ctx context.Context, client *elasticsearch.Client, policy RetryPolicy, indexName, query string) (*Validation, error) {
+	body, err := queryClause(query)
+	if err != nil {
+		return nil, err
+	}
+
+	var res *esapi.Response
+	err = retry(ctx, policy, endpointValidate, func() error {
+		var err error
+		res, err = client.Indices.ValidateQuery(
+			client.Indices.ValidateQuery.WithContext(ctx),
+			client.Indices.ValidateQuery.WithIndex(indexName),
+			client.Indices.ValidateQuery.WithBody(strings.NewReader(body)),
+			client.Indices.ValidateQuery.WithExplain(true),
+		)
+		return handleESResponse(res, err)
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("validate query failed: %w", err)
+	}
+	defer res.Body.Close()
+
+	var result Validation
+	if err := json.NewDecoder(res.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+	return &result, nil
+}
+
+// queryClause reduces a search body to its "query" clause.
+func queryClause(query string) (string, error) {
+	var body map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(query), &body); err != nil {
+		return "", fmt.Errorf("failed to parse query: %w", err)
+	}
+	clause := map[string]json.RawMessage{}
+	if q, ok := body["query"]; ok {
+		clause["query"] = q
+	}
+	b, err := json.Marshal(clause)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode query: %w", err)
+	}
+	return string(b), nil
+}
@@ -0,0 +1,51 @@
+// client/recover.go
+package client
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// ErrNotRecoverable is returned when a scroll or point in time has expired
+// and the search cannot be re-established without skipping or repeating
+// documents.
+var ErrNotRecoverable = errors.New("search context lost and cannot be re-established")
+
+// isContextLost reports whether err means the scroll or point in time no
+// longer exists, typically because a page took longer than the keep-alive
+// to process. Elasticsearch reports it as a search_context_missing_exception
+// root cause of a 404.
+func isContextLost(err error) bool {
+	var respErr *ResponseError
+	return errors.As(err, &respErr) &&
+		respErr.StatusCode == http.StatusNotFound &&
+		strings.Contains(respErr.Response, "search_context_missing_exception")
+}
+
+// checkRecoverable returns nil if a search with the given sort can continue
+// in a new search context after the hit with sort values searchAfter. The
+// sort must not rely on _doc or _shard_doc, which identify documents only
+// within one context, and should end on a field that is unique per document.
+func checkRecoverable(sort interface{}, searchAfter []interface{}) error {
+	if searchAfter == nil {
+		return fmt.Errorf("%w: the query has no sort to continue from", ErrNotRecoverable)
+	}
+	fields, ok := sort.([]interface{})
+	if !ok {
+		fields = []interface{}{sort}
+	}
+	for _, field := range fields {
+		name, _ := field.(string)
+		if object, ok := field.(map[string]interface{}); ok {
+			for key := range object {
+				name = key
+			}
+		}
+		if name == "_doc" || name == "_shard_doc" {
+			return fmt.Errorf("%w: sort on %s is not stable across search contexts, sort on a unique field instead", ErrNotRecoverable, name)
+		}
+	}
+	return nil
+}
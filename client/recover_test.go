@@ -0,0 +1,110 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v8"
+)
+
+// newExpiringScrollServer serves one page from a scroll, reports the scroll
+// as expired, and then answers point-in-time searches after sort value 1.
+func newExpiringScrollServer(t *testing.T, searchAfter *string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Elastic-Product", "Elasticsearch")
+		w.Header().Set("Content-Type", "application/json")
+
+		switch {
+		case r.URL.Path == "/logs/_search":
+			fmt.Fprint(w, `{"_scroll_id":"s1","hits":{"total":{"value":2},"hits":[
+				{"_index":"logs","_id":"1","_source":{},"sort":[1]}]}}`)
+		case r.URL.Path == "/_search/scroll":
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"error":{"root_cause":[{"type":"search_context_missing_exception","reason":"No search context found for id [1]"}],
+				"type":"search_phase_execution_exception"},"status":404}`)
+		case r.URL.Path == "/logs/_pit":
+			fmt.Fprint(w, `{"id":"pit1"}`)
+		case r.URL.Path == "/_search":
+			var body map[string]interface{}
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				t.Errorf("Error decoding search body: %s", err)
+			}
+			encoded, _ := json.Marshal(body["search_after"])
+			*searchAfter = string(encoded)
+			fmt.Fprint(w, `{"pit_id":"pit1","hits":{"total":{"value":2},"hits":[
+				{"_index":"logs","_id":"2","_source":{},"sort":[2]}]}}`)
+		case r.URL.Path == "/_pit" && r.Method == http.MethodDelete:
+			fmt.Fprint(w, `{"succeeded":true,"num_freed":1}`)
+		default:
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+}
+
+func TestESClientRecoversExpiredScroll(t *testing.T) {
+	var searchAfter string
+	server := newExpiringScrollServer(t, &searchAfter)
+	defer server.Close()
+
+	es, err := elasticsearch.NewClient(elasticsearch.Config{Addresses: []string{server.URL}})
+	if err != nil {
+		t.Fatalf("Error creating client: %s", err)
+	}
+	searcher := NewESClient(es, time.Minute, 1, "logs")
+
+	ctx := context.Background()
+	first, err := searcher.InitialSearch(ctx, `{"query":{"match_all":{}},"sort":[{"id":"asc"}]}`)
+	if err != nil {
+		t.Fatalf("Error running initial search: %s", err)
+	}
+	second, err := searcher.Scroll(ctx, first.ScrollID)
+	if err != nil {
+		t.Fatalf("Error scrolling: %s", err)
+	}
+
+	if !second.Recovered {
+		t.Errorf("Expected the page to be marked as recovered")
+	}
+	if len(second.Hits) != 1 || second.Hits[0].ID != "2" {
+		t.Errorf("Expected document 2 but got %+v", second.Hits)
+	}
+	if searchAfter != "[1]" {
+		t.Errorf("Expected search_after [1] but got %s", searchAfter)
+	}
+	if second.ScrollID != "pit1" {
+		t.Errorf("Expected to continue in point in time pit1, got %q", second.ScrollID)
+	}
+	if err := searcher.ClearScroll(ctx, second.ScrollID); err != nil {
+		t.Errorf("Error closing point in time: %s", err)
+	}
+}
+
+func TestESClientRefusesUnstableRecovery(t *testing.T) {
+	var searchAfter string
+	server := newExpiringScrollServer(t, &searchAfter)
+	defer server.Close()
+
+	es, err := elasticsearch.NewClient(elasticsearch.Config{Addresses: []string{server.URL}})
+	if err != nil {
+		t.Fatalf("Error creating client: %s", err)
+	}
+	searcher := NewESClient(es, time.Minute, 1, "logs")
+
+	ctx := context.Background()
+	first, err := searcher.InitialSearch(ctx, `{"query":{"match_all":{}},"sort":["_doc"]}`)
+	if err != nil {
+		t.Fatalf("Error running initial search: %s", err)
+	}
+	_, err = searcher.Scroll(ctx, first.ScrollID)
+	if !errors.Is(err, ErrNotRecoverable) || !strings.Contains(err.Error(), "_doc") {
+		t.Errorf("Expected ErrNotRecoverable naming _doc but got %v", err)
+	}
+}
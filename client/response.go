@@ -0,0 +1,106 @@
+// client/response.go
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	// ErrMissingScrollID is returned when a search response carries no
+	// scroll or point-in-time ID to continue from.
+	ErrMissingScrollID = errors.New("scroll ID not found in response")
+	// ErrMalformedResponse is returned when a search response does not have
+	// the shape of one, such as a missing "hits" object.
+	ErrMalformedResponse = errors.New("malformed search response")
+	// ErrShardFailures is matched by a *ShardFailureError.
+	ErrShardFailures = errors.New("search returned partial results")
+	// ErrMalformedHit is wrapped by the error of a MalformedHit.
+	ErrMalformedHit = errors.New("malformed hit")
+)
+
+// ShardFailure is one entry of _shards.failures.
+type ShardFailure struct {
+	Shard  int             `json:"shard"`
+	Index  string          `json:"index"`
+	Node   string          `json:"node"`
+	Reason json.RawMessage `json:"reason"`
+}
+
+// ShardFailureError reports a response that is missing results because some
+// shards failed or the search timed out. Exporting such a page would
+// silently drop documents, so it is an error rather than a warning.
+type ShardFailureError struct {
+	Total    int
+	Failed   int
+	TimedOut bool
+	Failures []ShardFailure
+}
+
+func (e *ShardFailureError) Error() string {
+	var reasons []string
+	for _, f := range e.Failures {
+		reasons = append(reasons, fmt.Sprintf("%s[%d]: %s", f.Index, f.Shard, f.Reason))
+	}
+	msg := fmt.Sprintf("%s: %d of %d shards failed", ErrShardFailures, e.Failed, e.Total)
+	if e.TimedOut {
+		msg += ", search timed out"
+	}
+	if len(reasons) > 0 {
+		msg += ": " + strings.Join(reasons, "; ")
+	}
+	return msg
+}
+
+func (e *ShardFailureError) Is(target error) bool { return target == ErrShardFailures }
+
+// MalformedHit is a hit that could not be turned into a Hit. Raw is the hit
+// as Elasticsearch returned it, so it can be kept for inspection.
+type MalformedHit struct {
+	Raw json.RawMessage
+	Err error
+}
+
+// checkShards returns a *ShardFailureError if the response timed out or
+// the _shards section reports failed shards.
+func checkShards(timedOut bool, shards map[string]interface{}) error {
+	var failed, total int64
+	if n := int64Field(shards, "failed"); n != nil {
+		failed = *n
+	}
+	if n := int64Field(shards, "total"); n != nil {
+		total = *n
+	}
+	if failed == 0 && !timedOut {
+		return nil
+	}
+
+	err := &ShardFailureError{Total: int(total), Failed: int(failed), TimedOut: timedOut}
+	if failures, ok := shards["failures"]; ok {
+		// Re-encode and decode rather than walk the map, tolerating any
+		// entry that does not match the expected shape.
+		if encoded, mErr := json.Marshal(failures); mErr == nil {
+			json.Unmarshal(encoded, &err.Failures)
+		}
+	}
+	return err
+}
+
+// totalHits reads hits.total, which is an object since Elasticsearch 7, a
+// number with rest_total_hits_as_int, and absent if total hits are not
+// tracked.
+func totalHits(v interface{}) int {
+	switch total := v.(type) {
+	case map[string]interface{}:
+		if n := int64Field(total, "value"); n != nil {
+			return int(*n)
+		}
+	case json.Number:
+		if n, err := total.Int64(); err == nil {
+			return int(n)
+		}
+	}
+	return 0
+}
@@ -0,0 +1,85 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParseScrollResponseRoutesMalformedHits(t *testing.T) {
+	body := `{
+		"_scroll_id": "abc",
+		"timed_out": false,
+		"_shards": {"total": 2, "successful": 2, "failed": 0},
+		"hits": {
+			"total": 4,
+			"hits": [
+				{"_index": "logs", "_id": "1", "_source": {"title": "Document 1"}, "sort": [1]},
+				{"_index": "logs", "_id": "2", "sort": [2]},
+				{"_index": "logs", "_source": {"title": "no id"}, "sort": [3]},
+				{"_index": "logs", "_id": "4", "_source": "not an object", "sort": [4]},
+				"not a hit"
+			]
+		}
+	}`
+	result, err := parseScrollResponse(strings.NewReader(body), nil)
+	if err != nil {
+		t.Fatalf("Error parsing response: %s", err)
+	}
+
+	if result.Total != 4 {
+		t.Errorf("Expected total 4 but got %d", result.Total)
+	}
+	if len(result.Hits) != 2 || result.Hits[0].ID != "1" || result.Hits[1].ID != "2" {
+		t.Fatalf("Expected hits 1 and 2 but got %+v", result.Hits)
+	}
+	if result.Hits[1].Source != nil {
+		t.Errorf("Expected nil _source for hit 2 but got %v", result.Hits[1].Source)
+	}
+	if len(result.Malformed) != 3 {
+		t.Fatalf("Expected 3 malformed hits but got %d", len(result.Malformed))
+	}
+	for _, hit := range result.Malformed {
+		if !errors.Is(hit.Err, ErrMalformedHit) {
+			t.Errorf("Expected ErrMalformedHit but got %v", hit.Err)
+		}
+	}
+	if string(result.Malformed[2].Raw) != `"not a hit"` {
+		t.Errorf("Expected raw hit to be kept, got %s", result.Malformed[2].Raw)
+	}
+	// The position comes from the last hit that had one, even a malformed one.
+	if len(result.SearchAfter) != 1 || result.SearchAfter[0] != json.Number("4") {
+		t.Errorf("Expected search_after [4] but got %v", result.SearchAfter)
+	}
+}
+
+func TestParseScrollResponseErrors(t *testing.T) {
+	tests := []struct {
+		body     string
+		expected error
+	}{
+		{`{"hits": {"hits": []}}`, ErrMissingScrollID},
+		{`{"_scroll_id": "abc"}`, ErrMalformedResponse},
+		{`{"_scroll_id": "abc", "hits": {"hits": {}}}`, ErrMalformedResponse},
+		{`{"_scroll_id": "abc", "_shards": {"total": 2, "failed": 1, "failures": [
+			{"shard": 1, "index": "logs", "node": "n1", "reason": {"type": "query_shard_exception"}}
+		]}, "hits": {"hits": []}}`, ErrShardFailures},
+		{`{"_scroll_id": "abc", "timed_out": true, "hits": {"hits": []}}`, ErrShardFailures},
+	}
+	for _, test := range tests {
+		_, err := parseScrollResponse(strings.NewReader(test.body), nil)
+		if !errors.Is(err, test.expected) {
+			t.Errorf("Expected %v for %s but got %v", test.expected, test.body, err)
+		}
+	}
+
+	_, err := parseScrollResponse(strings.NewReader(tests[3].body), nil)
+	var shardErr *ShardFailureError
+	if !errors.As(err, &shardErr) || shardErr.Failed != 1 || len(shardErr.Failures) != 1 {
+		t.Fatalf("Expected one shard failure but got %v", err)
+	}
+	if !strings.Contains(err.Error(), "query_shard_exception") {
+		t.Errorf("Expected failure reason in %q", err.Error())
+	}
+}
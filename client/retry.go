@@ -0,0 +1,280 @@
+// client/retry.go
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/elastic/go-elasticsearch/v8/esapi"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/terenzio/ElasticSearchQuerier/metrics"
+)
+
+// RetryPolicy is the exponential backoff applied to requests that fail with
+// a retryable error.
+type RetryPolicy struct {
+	InitialInterval time.Duration
+	MaxInterval     time.Duration
+	// MaxElapsedTime bounds the total time spent retrying one request.
+	MaxElapsedTime time.Duration
+}
+
+// DefaultRetryPolicy returns the policy clients use unless given another.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		InitialInterval: 1 * time.Second,
+		MaxInterval:     30 * time.Second,
+		MaxElapsedTime:  5 * time.Minute,
+	}
+}
+
+func (p RetryPolicy) newBackOff() *backoff.ExponentialBackOff {
+	b := backoff.NewExponentialBackOff()
+	b.InitialInterval = p.InitialInterval
+	b.MaxInterval = p.MaxInterval
+	b.MaxElapsedTime = p.MaxElapsedTime
+	return b
+}
+
+// ErrRequestFailed wraps errors where no response was received from
+// Elasticsearch, such as refused connections or timeouts.
+var ErrRequestFailed = errors.New("elasticsearch request failed")
+
+// ResponseError is returned when Elasticsearch answers with an error status.
+type ResponseError struct {
+	StatusCode int
+	// Type is the error.type of the response body, such as
+	// "index_not_found_exception", if it has one.
+	Type string
+	// Reason is the error.reason of the response body, followed by that of
+	// its first root cause if it has a different type.
+	Reason string
+	// RetryAfter is the delay asked for by a Retry-After header.
+	RetryAfter time.Duration
+	// Response is the status line and body, as rendered by esapi.Response.
+	// It is left out of Error, since bodies can echo queries, documents and
+	// the headers of the request.
+	Response string
+}
+
+// maxReasonLength bounds the reason quoted by Error.
+const maxReasonLength = 300
+
+func (e *ResponseError) Error() string {
+	msg := fmt.Sprintf("elasticsearch response error: [%d %s]", e.StatusCode, http.StatusText(e.StatusCode))
+	if e.Type != "" {
+		msg += " " + e.Type
+	}
+	if reason := e.Reason; reason != "" {
+		if len(reason) > maxReasonLength {
+			reason = reason[:maxReasonLength] + "..."
+		}
+		msg += ": " + reason
+	}
+	return msg
+}
+
+func handleESResponse(res *esapi.Response, err error) error {
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrRequestFailed, err)
+	}
+	if !res.IsError() {
+		return nil
+	}
+	defer res.Body.Close()
+
+	body, _ := io.ReadAll(res.Body)
+	errType, reason := errorCause(body)
+	respErr := &ResponseError{
+		StatusCode: res.StatusCode,
+		Type:       errType,
+		Reason:     reason,
+		RetryAfter: parseRetryAfter(res.Header.Get("Retry-After"), time.Now()),
+		Response:   fmt.Sprintf("[%d %s] %s", res.StatusCode, http.StatusText(res.StatusCode), body),
+	}
+	return respErr
+}
+
+// errorCause reads error.type and error.reason from an error response body.
+func errorCause(body []byte) (errType, reason string) {
+	var response struct {
+		Error json.RawMessage `json:"error"`
+	}
+	if json.Unmarshal(body, &response) != nil {
+		return "", ""
+	}
+	type cause struct {
+		Type   string `json:"type"`
+		Reason string `json:"reason"`
+	}
+	var c struct {
+		cause
+		RootCause []cause `json:"root_cause"`
+	}
+	// Some APIs report the error as a plain string.
+	if json.Unmarshal(response.Error, &c) != nil {
+		json.Unmarshal(response.Error, &c.Reason)
+		return "", c.Reason
+	}
+	reason = c.Reason
+	if len(c.RootCause) > 0 && c.RootCause[0].Type != c.Type {
+		reason += fmt.Sprintf(" (caused by %s: %s)", c.RootCause[0].Type, c.RootCause[0].Reason)
+	}
+	return c.Type, reason
+}
+
+// parseRetryAfter reads a Retry-After header given in seconds or as an HTTP
+// date.
+func parseRetryAfter(header string, now time.Time) time.Duration {
+	if header == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(header); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(header); err == nil && date.After(now) {
+		return date.Sub(now)
+	}
+	return 0
+}
+
+// Retryable status codes and error types. Other 4xx and 5xx responses are
+// the same however often they are sent: a bad query, a missing index, an
+// expired scroll or an internal error.
+var (
+	retryableStatus = map[int]bool{
+		http.StatusTooManyRequests:    true,
+		http.StatusBadGateway:         true,
+		http.StatusServiceUnavailable: true,
+		http.StatusGatewayTimeout:     true,
+	}
+	retryableTypes = map[string]bool{
+		"es_rejected_execution_exception":     true,
+		"circuit_breaking_exception":          true,
+		"cluster_block_exception":             true,
+		"no_shard_available_action_exception": true,
+		"node_not_connected_exception":        true,
+		"node_disconnected_exception":         true,
+	}
+)
+
+// IsRetryable reports whether a request that failed with err may succeed if
+// it is sent again. Rejections under load, gateway errors and lost
+// connections are retryable; other error responses, cancellation and TLS
+// verification failures are not.
+func IsRetryable(err error) bool {
+	var respErr *ResponseError
+	if errors.As(err, &respErr) {
+		return retryableStatus[respErr.StatusCode] || retryableTypes[respErr.Type]
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var (
+		unknownAuthority x509.UnknownAuthorityError
+		invalidCert      x509.CertificateInvalidError
+		hostname         x509.HostnameError
+		verification     *tls.CertificateVerificationError
+	)
+	if errors.As(err, &unknownAuthority) || errors.As(err, &invalidCert) ||
+		errors.As(err, &hostname) || errors.As(err, &verification) {
+		return false
+	}
+	return errors.Is(err, ErrRequestFailed)
+}
+
+// retry calls operation until it succeeds, fails with an error that is not
+// retryable, or policy gives up. It waits at least as long as a
+// Retry-After header asks for, within the intervals of policy, and stops
+// waiting as soon as ctx is done. Every attempt is recorded in the request
+// metrics of endpoint, and every retry as an event of the span of ctx.
+func retry(ctx context.Context, policy RetryPolicy, endpoint string, operation func() error) error {
+	b := &retryBackOff{
+		BackOff:  backoff.WithContext(policy.newBackOff(), ctx),
+		ctx:      ctx,
+		policy:   policy,
+		start:    time.Now(),
+		endpoint: endpoint,
+		span:     trace.SpanFromContext(ctx),
+	}
+	return backoff.Retry(func() error {
+		start := time.Now()
+		err := operation()
+		observeRequest(endpoint, start, err)
+		if err == nil {
+			return nil
+		}
+		if !IsRetryable(err) {
+			return backoff.Permanent(err)
+		}
+		b.err = err
+		var respErr *ResponseError
+		if errors.As(err, &respErr) {
+			b.retryAfter = respErr.RetryAfter
+		}
+		return err
+	}, b)
+}
+
+// retryBackOff stretches the next interval to the last Retry-After delay,
+// and records the retries it allows.
+type retryBackOff struct {
+	backoff.BackOff
+	ctx        context.Context
+	policy     RetryPolicy
+	start      time.Time
+	endpoint   string
+	span       trace.Span
+	attempts   int
+	err        error
+	retryAfter time.Duration
+}
+
+// Context returns the context of the request, which backoff.Retry watches
+// while it waits. The embedded BackOff would otherwise hide it.
+func (b *retryBackOff) Context() context.Context {
+	return b.ctx
+}
+
+func (b *retryBackOff) NextBackOff() time.Duration {
+	next := b.BackOff.NextBackOff()
+	if next != backoff.Stop {
+		// A Retry-After delay is honoured up to the longest interval and
+		// the time left to retry, so a large one cannot stall the caller
+		retryAfter := min(b.retryAfter, b.policy.MaxInterval)
+		if b.policy.MaxElapsedTime > 0 {
+			retryAfter = min(retryAfter, b.policy.MaxElapsedTime-time.Since(b.start))
+		}
+		next = max(next, retryAfter)
+	}
+	b.retryAfter = 0
+	b.attempts++
+	if next != backoff.Stop {
+		metrics.Retries.WithLabelValues(b.endpoint).Inc()
+		attrs := []attribute.KeyValue{
+			attribute.String("endpoint", b.endpoint),
+			attribute.Int("attempt", b.attempts),
+			attribute.String("error", b.err.Error()),
+			attribute.String("error.class", errorClass(b.err)),
+			attribute.Int64("backoff_ms", next.Milliseconds()),
+		}
+		var respErr *ResponseError
+		if errors.As(b.err, &respErr) {
+			attrs = append(attrs, attribute.Int("http.response.status_code", respErr.StatusCode))
+		}
+		b.span.AddEvent("retry", trace.WithAttributes(attrs...))
+	}
+	return next
+}
@@ -0,0 +1,150 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v8"
+)
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		err      error
+		expected bool
+	}{
+		{&ResponseError{StatusCode: 429}, true},
+		{&ResponseError{StatusCode: 503}, true},
+		{&ResponseError{StatusCode: 400, Type: "parsing_exception"}, false},
+		{&ResponseError{StatusCode: 404, Type: "index_not_found_exception"}, false},
+		{&ResponseError{StatusCode: 404, Type: "search_context_missing_exception"}, false},
+		{&ResponseError{StatusCode: 500, Type: "circuit_breaking_exception"}, true},
+		{fmt.Errorf("%w: %w", ErrRequestFailed, errors.New("connection reset by peer")), true},
+		{fmt.Errorf("%w: %w", ErrRequestFailed, context.Canceled), false},
+		{errors.New("failed to parse response"), false},
+	}
+	for _, test := range tests {
+		if got := IsRetryable(test.err); got != test.expected {
+			t.Errorf("Expected IsRetryable(%v) to be %v", test.err, test.expected)
+		}
+	}
+}
+
+func TestResponseErrorOmitsBody(t *testing.T) {
+	body := `{"error":{"root_cause":[{"type":"query_shard_exception","reason":"failed to create query"}],` +
+		`"type":"search_phase_execution_exception","reason":"all shards failed"},` +
+		`"query":{"term":{"password":"hunter2"}},"status":400}`
+	errType, reason := errorCause([]byte(body))
+	err := &ResponseError{StatusCode: 400, Type: errType, Reason: reason, Response: "[400 Bad Request] " + body}
+
+	expected := "elasticsearch response error: [400 Bad Request] search_phase_execution_exception: " +
+		"all shards failed (caused by query_shard_exception: failed to create query)"
+	if err.Error() != expected {
+		t.Errorf("Expected %q but got %q", expected, err.Error())
+	}
+
+	errType, reason = errorCause([]byte(`{"error":"Incorrect HTTP method for uri","status":405}`))
+	if errType != "" || reason != "Incorrect HTTP method for uri" {
+		t.Errorf("Expected the reason of a plain error string but got %q, %q", errType, reason)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := map[string]time.Duration{
+		"":                              0,
+		"3":                             3 * time.Second,
+		"Mon, 01 Jan 2024 12:00:05 GMT": 5 * time.Second,
+		"soon":                          0,
+	}
+	for header, expected := range tests {
+		if got := parseRetryAfter(header, now); got != expected {
+			t.Errorf("Expected %s for %q but got %s", expected, header, got)
+		}
+	}
+}
+
+func TestRetryClassifiesResponses(t *testing.T) {
+	policy := RetryPolicy{InitialInterval: time.Millisecond, MaxInterval: 2 * time.Second, MaxElapsedTime: 5 * time.Second}
+
+	var statuses []int
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Elastic-Product", "Elasticsearch")
+		w.Header().Set("Content-Type", "application/json")
+		status := statuses[requests]
+		requests++
+		if status == http.StatusTooManyRequests {
+			w.Header().Set("Retry-After", "1")
+		}
+		w.WriteHeader(status)
+		if status == http.StatusBadRequest {
+			fmt.Fprint(w, `{"error":{"type":"parsing_exception","reason":"unknown query [matc]"},"status":400}`)
+			return
+		}
+		fmt.Fprint(w, `{"count":3}`)
+	}))
+	defer server.Close()
+
+	es, err := elasticsearch.NewClient(elasticsearch.Config{Addresses: []string{server.URL}})
+	if err != nil {
+		t.Fatalf("Error creating client: %s", err)
+	}
+
+	// A rejected query fails at once.
+	statuses, requests = []int{400, 200}, 0
+	_, err = Count(context.Background(), es, policy, "logs", `{"query":{"matc":{}}}`)
+	var respErr *ResponseError
+	if !errors.As(err, &respErr) || respErr.Type != "parsing_exception" {
+		t.Fatalf("Expected parsing_exception but got %v", err)
+	}
+	if requests != 1 {
+		t.Errorf("Expected 1 request but got %d", requests)
+	}
+
+	// A rejection under load is retried after Retry-After.
+	statuses, requests = []int{429, 200}, 0
+	start := time.Now()
+	count, err := Count(context.Background(), es, policy, "logs", `{"query":{"match_all":{}}}`)
+	if err != nil {
+		t.Fatalf("Error counting: %s", err)
+	}
+	if count != 3 || requests != 2 {
+		t.Errorf("Expected count 3 after 2 requests but got %d after %d", count, requests)
+	}
+	if waited := time.Since(start); waited < time.Second {
+		t.Errorf("Expected to wait for Retry-After, waited %s", waited)
+	}
+
+	// But no longer than the longest interval of the policy.
+	statuses, requests = []int{429, 200}, 0
+	start = time.Now()
+	policy.MaxInterval = 10 * time.Millisecond
+	if _, err := Count(context.Background(), es, policy, "logs", `{"query":{"match_all":{}}}`); err != nil {
+		t.Fatalf("Error counting: %s", err)
+	}
+	if waited := time.Since(start); waited > 500*time.Millisecond {
+		t.Errorf("Expected Retry-After to be capped at %s, waited %s", policy.MaxInterval, waited)
+	}
+}
+
+func TestRetryStopsWaitingWhenCancelled(t *testing.T) {
+	policy := RetryPolicy{InitialInterval: 3 * time.Second, MaxInterval: 3 * time.Second, MaxElapsedTime: time.Minute}
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	start := time.Now()
+	err := retry(ctx, policy, endpointSearch, func() error {
+		return &ResponseError{StatusCode: http.StatusTooManyRequests, RetryAfter: time.Hour}
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled but got %v", err)
+	}
+	if waited := time.Since(start); waited > time.Second {
+		t.Errorf("Expected retry to return once cancelled, waited %s", waited)
+	}
+}
@@ -0,0 +1,77 @@
+// client/searcher.go
+package client
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v8"
+)
+
+// Pagination modes accepted by NewSearcher.
+const (
+	ModeScroll = "scroll"
+	ModePIT    = "pit"
+)
+
+// Searcher pages through the results of a query. InitialSearch returns the
+// first page; Scroll is called with the ScrollID of the previous result until
+// a page comes back empty; ClearScroll releases the server-side context.
+type Searcher interface {
+	InitialSearch(ctx context.Context, query string) (*ScrollResult, error)
+	Scroll(ctx context.Context, scrollID string) (*ScrollResult, error)
+	ClearScroll(ctx context.Context, scrollID string) error
+}
+
+// Resumer is implemented by searchers that can continue a search after the
+// hit with the given sort values, as recorded in a checkpoint. scrollID is
+// the search context to continue in and may no longer exist.
+type Resumer interface {
+	Resume(ctx context.Context, query, scrollID string, searchAfter []interface{}) (*ScrollResult, error)
+}
+
+// Logger is implemented by searchers that log, which is to say warn about
+// expired search contexts and failures to release them.
+type Logger interface {
+	SetLogger(logger *slog.Logger)
+}
+
+// Retrier is implemented by searchers that retry failed requests.
+type Retrier interface {
+	SetRetryPolicy(policy RetryPolicy)
+}
+
+// loggerOf returns the logger of searcher, or slog.Default().
+func loggerOf(searcher Searcher) *slog.Logger {
+	if s, ok := searcher.(interface{ logger() *slog.Logger }); ok {
+		return s.logger()
+	}
+	return slog.Default()
+}
+
+var (
+	_ Searcher = (*ESClient)(nil)
+	_ Searcher = (*PITClient)(nil)
+	_ Resumer  = (*PITClient)(nil)
+	_ Streamer = (*ESClient)(nil)
+	_ Streamer = (*PITClient)(nil)
+	_ Logger   = (*ESClient)(nil)
+	_ Logger   = (*PITClient)(nil)
+	_ Retrier  = (*ESClient)(nil)
+	_ Retrier  = (*PITClient)(nil)
+)
+
+// NewSearcher returns the pagination engine for mode. keepAlive is the scroll
+// duration or point-in-time keep-alive respectively.
+func NewSearcher(mode string, client *elasticsearch.Client, keepAlive time.Duration, batchSize int, indexName string) (Searcher, error) {
+	switch mode {
+	case ModeScroll, "":
+		return NewESClient(client, keepAlive, batchSize, indexName), nil
+	case ModePIT:
+		return NewPITClient(client, keepAlive, batchSize, indexName), nil
+	default:
+		return nil, fmt.Errorf("unknown pagination mode %q", mode)
+	}
+}
@@ -0,0 +1,245 @@
+// client/sliced.go
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/terenzio/ElasticSearchQuerier/logging"
+)
+
+// Page is one page of hits fetched by a single slice of a sliced search.
+// Streamed counts the hits that were passed to a HitHandler rather than
+// collected in Hits; see StreamSearchFrom. Malformed holds the hits of the
+// page that could not be parsed, and Recovered is set if the slice's search
+// context had to be re-established to fetch it. ScrollID and SearchAfter
+// are the position of the slice after the page, which is what a checkpoint
+// records.
+type Page struct {
+	Slice       int
+	Number      int
+	TotalPages  int
+	Hits        []Hit
+	Streamed    int
+	Malformed   []MalformedHit
+	Recovered   bool
+	ScrollID    string
+	SearchAfter []interface{}
+}
+
+// Position is where a slice of a resumed sliced search continues: after
+// the hit with sort values SearchAfter, in the search context ScrollID, with
+// Pages pages already handled. The zero Position starts from the beginning.
+type Position struct {
+	ScrollID    string
+	SearchAfter []interface{}
+	Pages       int
+}
+
+// SearcherFactory returns a fresh Searcher. Searchers keep per-search state,
+// so every slice needs its own.
+type SearcherFactory func() (Searcher, error)
+
+const (
+	// pageBuffer is how many pages each slice may fetch ahead of the writer.
+	pageBuffer = 2
+	// clearTimeout bounds the request releasing a slice's search context.
+	clearTimeout = 10 * time.Second
+)
+
+// SlicedSearch splits query into slices sliced searches, runs each one in its
+// own goroutine and passes the pages to handle. handle is only ever called
+// from the calling goroutine, so it may write to a shared sink without
+// locking.
+//
+// Pages are merged round-robin in slice order: page 1 of slice 0, page 1 of
+// slice 1, ..., page 2 of slice 0 and so on, skipping slices that are done.
+// The output order is therefore the same from run to run regardless of which
+// worker happens to be fastest.
+//
+// With slices <= 1 the query is run unsliced on a single searcher.
+func SlicedSearch(ctx context.Context, newSearcher SearcherFactory, query string, slices int, handle func(*Page) error) error {
+	if slices < 1 {
+		slices = 1
+	}
+	return SlicedSearchFrom(ctx, newSearcher, query, make([]Position, slices), handle)
+}
+
+// SlicedSearchFrom is SlicedSearch with one slice per element of from,
+// each continuing from its position. Resuming a slice requires searchers
+// that implement Resumer.
+func SlicedSearchFrom(ctx context.Context, newSearcher SearcherFactory, query string, from []Position, handle func(*Page) error) error {
+	slices := len(from)
+	if slices == 0 {
+		return fmt.Errorf("sliced search needs at least one slice")
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+	)
+	fail := func(err error) {
+		errOnce.Do(func() {
+			firstErr = err
+			cancel()
+		})
+	}
+
+	pages := make([]chan *Page, slices)
+	for i := range pages {
+		pages[i] = make(chan *Page, pageBuffer)
+	}
+
+	for i := 0; i < slices; i++ {
+		sliceQuery := query
+		if slices > 1 {
+			var err error
+			if sliceQuery, err = SliceQuery(query, i, slices); err != nil {
+				return err
+			}
+		}
+
+		wg.Add(1)
+		go func(slice int, query string) {
+			defer wg.Done()
+			defer close(pages[slice])
+			searcher, err := newSearcher()
+			if err != nil {
+				fail(fmt.Errorf("slice %d: %w", slice, err))
+				return
+			}
+			err = runSlice(ctx, searcher, query, slice, from[slice], func(page *Page) error {
+				select {
+				case pages[slice] <- page:
+					return nil
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			})
+			if err != nil {
+				fail(fmt.Errorf("slice %d: %w", slice, err))
+			}
+		}(i, sliceQuery)
+	}
+
+	open := slices
+	for open > 0 {
+		open = 0
+		for i := range pages {
+			if pages[i] == nil {
+				continue
+			}
+			page, ok := <-pages[i]
+			if !ok {
+				pages[i] = nil
+				continue
+			}
+			open++
+			if ctx.Err() != nil {
+				// Drain the remaining pages so the workers can exit.
+				continue
+			}
+			if err := handle(page); err != nil {
+				fail(err)
+			}
+		}
+	}
+
+	wg.Wait()
+	return firstErr
+}
+
+// runSlice pages through one slice with searcher, passing each page to emit.
+func runSlice(ctx context.Context, searcher Searcher, query string, slice int, from Position, emit func(*Page) error) error {
+	var (
+		result *ScrollResult
+		err    error
+	)
+	if from.SearchAfter != nil {
+		resumer, ok := searcher.(Resumer)
+		if !ok {
+			return fmt.Errorf("pagination mode cannot resume a search")
+		}
+		spanCtx, span := startSpan(ctx, "Resume", slice, from.Pages+1)
+		result, err = resumer.Resume(spanCtx, query, from.ScrollID, from.SearchAfter)
+		endSpan(span, result, err)
+	} else {
+		spanCtx, span := startSpan(ctx, "InitialSearch", slice, from.Pages+1)
+		result, err = searcher.InitialSearch(spanCtx, query)
+		endSpan(span, result, err)
+	}
+	if err != nil {
+		return err
+	}
+	defer func() {
+		// Use a fresh context so the search context is released even if the
+		// export was cancelled, but do not hold up a shutdown for long.
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), clearTimeout)
+		defer cancel()
+		ctx, span := startSpan(ctx, "ClearScroll", slice, 0)
+		err := searcher.ClearScroll(ctx, result.ScrollID)
+		endSpan(span, nil, err)
+		if err != nil {
+			loggerOf(searcher).Warn("Failed to clear scroll",
+				"slice", slice, logging.ScrollID(result.ScrollID), "error", err)
+		}
+	}()
+
+	page := &Page{
+		Slice:      slice,
+		Number:     from.Pages + 1,
+		TotalPages: countPages(result.Total, result.Len()),
+	}
+	for result.Len() > 0 {
+		page.Hits = result.Hits
+		page.Streamed = result.Streamed
+		page.Malformed = result.Malformed
+		page.Recovered = result.Recovered
+		page.ScrollID = result.ScrollID
+		page.SearchAfter = result.SearchAfter
+		if err := emit(page); err != nil {
+			return err
+		}
+
+		// A streaming searcher writes the hits of the page while it is
+		// being fetched, within this span.
+		spanCtx, span := startSpan(ctx, "Scroll", slice, page.Number+1)
+		next, err := searcher.Scroll(spanCtx, result.ScrollID)
+		endSpan(span, next, err)
+		if err != nil {
+			return err
+		}
+		result = next
+		page = &Page{Slice: slice, Number: page.Number + 1, TotalPages: page.TotalPages}
+	}
+	return nil
+}
+
+func countPages(total, pageSize int) int {
+	if pageSize == 0 {
+		return 0
+	}
+	return (total + pageSize - 1) / pageSize
+}
+
+// SliceQuery adds a slice clause selecting slice id of max to query.
+func SliceQuery(query string, id, max int) (string, error) {
+	var body map[string]interface{}
+	if err := json.Unmarshal([]byte(query), &body); err != nil {
+		return "", fmt.Errorf("failed to parse query: %w", err)
+	}
+	body["slice"] = map[string]interface{}{"id": id, "max": max}
+
+	sliced, err := json.Marshal(body)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode query: %w", err)
+	}
+	return string(sliced), nil
+}
@@ -0,0 +1,134 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// fakeSearcher serves pages of one document each for the slice named in the
+// query, so the merge order can be checked without a cluster.
+type fakeSearcher struct {
+	pagesPerSlice []int
+	slice         int
+	page          int
+}
+
+func (s *fakeSearcher) InitialSearch(ctx context.Context, query string) (*ScrollResult, error) {
+	var body struct {
+		Slice struct {
+			ID int `json:"id"`
+		} `json:"slice"`
+	}
+	if err := json.Unmarshal([]byte(query), &body); err != nil {
+		return nil, err
+	}
+	s.slice = body.Slice.ID
+	return s.Scroll(ctx, "")
+}
+
+func (s *fakeSearcher) Scroll(ctx context.Context, scrollID string) (*ScrollResult, error) {
+	s.page++
+	pages := s.pagesPerSlice[s.slice]
+	result := &ScrollResult{ScrollID: "scroll", Total: pages}
+	if s.page <= pages {
+		result.Hits = []Hit{
+			{Source: map[string]interface{}{"title": fmt.Sprintf("s%d-p%d", s.slice, s.page)}},
+		}
+	}
+	return result, nil
+}
+
+func (s *fakeSearcher) ClearScroll(ctx context.Context, scrollID string) error {
+	return nil
+}
+
+func TestSlicedSearchMergesInSliceOrder(t *testing.T) {
+	pagesPerSlice := []int{2, 3, 1}
+	newSearcher := func() (Searcher, error) {
+		return &fakeSearcher{pagesPerSlice: pagesPerSlice}, nil
+	}
+
+	var got []string
+	err := SlicedSearch(context.Background(), newSearcher, `{"query":{"match_all":{}}}`, len(pagesPerSlice), func(page *Page) error {
+		for _, hit := range page.Hits {
+			got = append(got, hit.Source["title"].(string))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Error running sliced search: %s", err)
+	}
+
+	expected := "s0-p1 s1-p1 s2-p1 s0-p2 s1-p2 s1-p3"
+	if strings.Join(got, " ") != expected {
+		t.Errorf("Expected %q but got %q", expected, strings.Join(got, " "))
+	}
+}
+
+func TestSlicedSearchStopsOnHandlerError(t *testing.T) {
+	newSearcher := func() (Searcher, error) {
+		return &fakeSearcher{pagesPerSlice: []int{100, 100, 100, 100}}, nil
+	}
+
+	calls := 0
+	err := SlicedSearch(context.Background(), newSearcher, `{}`, 4, func(page *Page) error {
+		calls++
+		return fmt.Errorf("disk full")
+	})
+	if err == nil || !strings.Contains(err.Error(), "disk full") {
+		t.Fatalf("Expected handler error but got %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("Expected handler to be called once but got %d calls", calls)
+	}
+}
+
+// resumingSearcher is a fakeSearcher that can resume after a page number
+// carried as the sort value of its last hit.
+type resumingSearcher struct {
+	fakeSearcher
+}
+
+func (s *resumingSearcher) Resume(ctx context.Context, query, scrollID string, searchAfter []interface{}) (*ScrollResult, error) {
+	if _, err := s.InitialSearch(ctx, query); err != nil {
+		return nil, err
+	}
+	s.page = searchAfter[0].(int)
+	return s.Scroll(ctx, scrollID)
+}
+
+func (s *resumingSearcher) Scroll(ctx context.Context, scrollID string) (*ScrollResult, error) {
+	result, err := s.fakeSearcher.Scroll(ctx, scrollID)
+	if err == nil {
+		result.SearchAfter = []interface{}{s.page}
+	}
+	return result, err
+}
+
+func TestSlicedSearchFromResumesSlices(t *testing.T) {
+	newSearcher := func() (Searcher, error) {
+		return &resumingSearcher{fakeSearcher{pagesPerSlice: []int{3, 2}}}, nil
+	}
+
+	// Slice 0 had written two pages, slice 1 none.
+	from := []Position{{ScrollID: "pit", SearchAfter: []interface{}{2}, Pages: 2}, {}}
+
+	var got []string
+	err := SlicedSearchFrom(context.Background(), newSearcher, `{}`, from, func(page *Page) error {
+		for _, hit := range page.Hits {
+			got = append(got, fmt.Sprintf("%s#%d", hit.Source["title"], page.Number))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Error running sliced search: %s", err)
+	}
+
+	expected := "s0-p3#3 s1-p1#1 s1-p2#2"
+	if strings.Join(got, " ") != expected {
+		t.Errorf("Expected %q but got %q", expected, strings.Join(got, " "))
+	}
+}
@@ -0,0 +1,224 @@
+// client/stream.go
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// HitHandler receives the hits of a streamed search one at a time, in the
+// order they are read off the response. An error stops the search.
+type HitHandler func(Hit) error
+
+// Streamer is implemented by searchers that can pass hits to a handler as
+// they are decoded rather than collecting the whole page. Once Stream has
+// been called, hits are no longer returned in ScrollResult.Hits; Streamed
+// counts them instead. Malformed hits are still collected.
+type Streamer interface {
+	Stream(handle HitHandler)
+}
+
+// Len returns the number of hits on the page, streamed or not, including
+// malformed ones. A page of length 0 ends the search.
+func (r *ScrollResult) Len() int {
+	return r.Streamed + len(r.Hits) + len(r.Malformed)
+}
+
+// StreamSearchFrom runs query on a single searcher from position from,
+// passing every hit to onHit as it is read off the response and then the
+// finished page to handle. Unlike SlicedSearchFrom nothing is fetched ahead
+// and both callbacks run on the calling goroutine, so at most one document
+// is held in memory and handle sees a page only once all its hits have
+// been passed to onHit. The searcher must implement Streamer.
+func StreamSearchFrom(ctx context.Context, newSearcher SearcherFactory, query string, from Position, onHit HitHandler, handle func(*Page) error) error {
+	searcher, err := newSearcher()
+	if err != nil {
+		return err
+	}
+	streamer, ok := searcher.(Streamer)
+	if !ok {
+		return fmt.Errorf("pagination mode cannot stream hits")
+	}
+	streamer.Stream(onHit)
+
+	return runSlice(ctx, searcher, query, 0, from, handle)
+}
+
+// decodeSearchResponse reads a search response off body token by token.
+// Each hit is decoded on its own by decodeHit before the next one is read,
+// so with streamHits a page is never held in memory as a whole; a nil
+// decodeHit collects the hits in the result. idKey is the field holding the
+// search context ID, "_scroll_id" or "pit_id".
+//
+// Elasticsearch writes timed_out and _shards ahead of hits, so a page with
+// shard failures is rejected before any of its hits is handed over.
+func decodeSearchResponse(body io.Reader, idKey string, decodeHit hitDecoder) (*ScrollResult, error) {
+	dec := newDecoder(body)
+
+	if err := expectDelim(dec, '{'); err != nil {
+		return nil, err
+	}
+
+	result := &ScrollResult{}
+	var (
+		hasID    bool
+		hasHits  bool
+		timedOut bool
+		shards   map[string]interface{}
+	)
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse response: %w", err)
+		}
+		switch key {
+		case idKey:
+			err = decodeValue(dec, &result.ScrollID)
+			hasID = true
+		case "timed_out":
+			err = decodeValue(dec, &timedOut)
+		case "_shards":
+			err = decodeValue(dec, &shards)
+		case "hits":
+			if err := checkShards(timedOut, shards); err != nil {
+				return nil, err
+			}
+			err = decodeHits(dec, result, decodeHit)
+			hasHits = true
+		default:
+			err = decodeValue(dec, &json.RawMessage{})
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := expectDelim(dec, '}'); err != nil {
+		return nil, err
+	}
+
+	if !hasID {
+		return nil, ErrMissingScrollID
+	}
+	if err := checkShards(timedOut, shards); err != nil {
+		return nil, err
+	}
+	if !hasHits {
+		return nil, fmt.Errorf("%w: no hits object", ErrMalformedResponse)
+	}
+	return result, nil
+}
+
+// decodeHits reads the hits object, passing each hit of hits.hits to
+// decodeHit.
+func decodeHits(dec *json.Decoder, result *ScrollResult, decodeHit hitDecoder) error {
+	if err := expectDelim(dec, '{'); err != nil {
+		return fmt.Errorf("%w: no hits object", ErrMalformedResponse)
+	}
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			return fmt.Errorf("failed to parse response: %w", err)
+		}
+		switch key {
+		case "total":
+			var total interface{}
+			if err := decodeValue(dec, &total); err != nil {
+				return err
+			}
+			result.Total = totalHits(total)
+		case "hits":
+			if err := decodeHitArray(dec, result, decodeHit); err != nil {
+				return err
+			}
+		default:
+			if err := decodeValue(dec, &json.RawMessage{}); err != nil {
+				return err
+			}
+		}
+	}
+	return expectDelim(dec, '}')
+}
+
+// hitDecoder decodes the next element of hits.hits off dec and records it
+// in result.
+type hitDecoder func(dec *json.Decoder, result *ScrollResult) error
+
+// streamHits returns a hitDecoder passing each hit to onHit, or collecting
+// it in result.Hits if onHit is nil. Hits that are not well formed are
+// collected in result.Malformed.
+func streamHits(onHit HitHandler) hitDecoder {
+	return func(dec *json.Decoder, result *ScrollResult) error {
+		var raw interface{}
+		if err := decodeValue(dec, &raw); err != nil {
+			return err
+		}
+		// Take the position from every hit that has one, even a malformed
+		// hit, so the next page does not return it again.
+		if hitMap, ok := raw.(map[string]interface{}); ok {
+			if sort, ok := hitMap["sort"].([]interface{}); ok {
+				result.SearchAfter = sort
+			}
+		}
+
+		hit, err := newHit(raw)
+		if err != nil {
+			encoded, _ := json.Marshal(raw)
+			result.Malformed = append(result.Malformed, MalformedHit{Raw: encoded, Err: err})
+			return nil
+		}
+		if onHit == nil {
+			result.Hits = append(result.Hits, hit)
+			return nil
+		}
+		if err := onHit(hit); err != nil {
+			return err
+		}
+		result.Streamed++
+		return nil
+	}
+}
+
+func decodeHitArray(dec *json.Decoder, result *ScrollResult, decodeHit hitDecoder) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+	if tok == nil {
+		return nil
+	}
+	if tok != json.Delim('[') {
+		return fmt.Errorf("%w: hits.hits is not an array", ErrMalformedResponse)
+	}
+
+	if decodeHit == nil {
+		decodeHit = streamHits(nil)
+	}
+	for dec.More() {
+		if err := decodeHit(dec, result); err != nil {
+			return err
+		}
+	}
+	return expectDelim(dec, ']')
+}
+
+// decodeValue decodes the next value into v.
+func decodeValue(dec *json.Decoder, v interface{}) error {
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+	return nil
+}
+
+// expectDelim reads the next token, which must be delim.
+func expectDelim(dec *json.Decoder, delim json.Delim) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+	if tok != delim {
+		return fmt.Errorf("%w: expected %s but got %v", ErrMalformedResponse, delim, tok)
+	}
+	return nil
+}
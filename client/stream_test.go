@@ -0,0 +1,236 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v8"
+)
+
+func TestParseScrollResponseStreamsHits(t *testing.T) {
+	body := `{
+		"_scroll_id": "abc",
+		"took": 3,
+		"_shards": {"total": 1, "successful": 1, "failed": 0},
+		"hits": {
+			"total": {"value": 3, "relation": "eq"},
+			"max_score": null,
+			"hits": [
+				{"_index": "logs", "_id": "1", "_source": {"n": 1}, "sort": [1]},
+				{"_index": "logs", "_source": {"n": 2}, "sort": [2]},
+				{"_index": "logs", "_id": "3", "_source": {"n": 3}, "sort": [3]}
+			]
+		}
+	}`
+
+	var ids []string
+	result, err := parseScrollResponse(strings.NewReader(body), streamHits(func(hit Hit) error {
+		ids = append(ids, hit.ID)
+		return nil
+	}))
+	if err != nil {
+		t.Fatalf("Error parsing response: %s", err)
+	}
+
+	if strings.Join(ids, " ") != "1 3" {
+		t.Errorf("Expected hits 1 and 3 to be streamed but got %v", ids)
+	}
+	if len(result.Hits) != 0 || result.Streamed != 2 || len(result.Malformed) != 1 {
+		t.Errorf("Expected 2 streamed and 1 malformed hit but got %+v", result)
+	}
+	if result.Len() != 3 || result.Total != 3 || result.ScrollID != "abc" {
+		t.Errorf("Expected a page of 3 of 3 hits in scroll abc but got %+v", result)
+	}
+}
+
+func TestParseScrollResponseRejectsShardFailuresBeforeStreaming(t *testing.T) {
+	body := `{"_scroll_id": "abc", "_shards": {"total": 2, "failed": 1},
+		"hits": {"hits": [{"_index": "logs", "_id": "1", "_source": {}}]}}`
+
+	streamed := 0
+	_, err := parseScrollResponse(strings.NewReader(body), streamHits(func(hit Hit) error {
+		streamed++
+		return nil
+	}))
+	if !errors.Is(err, ErrShardFailures) {
+		t.Errorf("Expected ErrShardFailures but got %v", err)
+	}
+	if streamed != 0 {
+		t.Errorf("Expected no hits to be streamed but got %d", streamed)
+	}
+}
+
+func TestStreamSearchFrom(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Elastic-Product", "Elasticsearch")
+		w.Header().Set("Content-Type", "application/json")
+
+		switch {
+		case r.URL.Path == "/logs/_search":
+			fmt.Fprint(w, `{"_scroll_id":"s1","hits":{"total":{"value":3},"hits":[
+				{"_index":"logs","_id":"1","_source":{}},{"_index":"logs","_id":"2","_source":{}}]}}`)
+		case strings.HasPrefix(r.URL.Path, "/_search/scroll") && r.Method == http.MethodDelete:
+			fmt.Fprint(w, `{"succeeded":true}`)
+		case strings.HasPrefix(r.URL.Path, "/_search/scroll"):
+			if r.URL.Query().Get("scroll_id") == "s1" {
+				fmt.Fprint(w, `{"_scroll_id":"s2","hits":{"hits":[{"_index":"logs","_id":"3","_source":{}}]}}`)
+			} else {
+				fmt.Fprint(w, `{"_scroll_id":"s2","hits":{"hits":[]}}`)
+			}
+		default:
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+
+	es, err := elasticsearch.NewClient(elasticsearch.Config{Addresses: []string{server.URL}})
+	if err != nil {
+		t.Fatalf("Error creating client: %s", err)
+	}
+	newSearcher := func() (Searcher, error) {
+		return NewESClient(es, time.Minute, 2, "logs"), nil
+	}
+
+	var events []string
+	err = StreamSearchFrom(context.Background(), newSearcher, `{"query":{"match_all":{}}}`, Position{},
+		func(hit Hit) error {
+			events = append(events, "hit "+hit.ID)
+			return nil
+		},
+		func(page *Page) error {
+			events = append(events, fmt.Sprintf("page %d of %d: %d", page.Number, page.TotalPages, page.Streamed))
+			return nil
+		})
+	if err != nil {
+		t.Fatalf("Error streaming search: %s", err)
+	}
+
+	expected := "hit 1, hit 2, page 1 of 2: 2, hit 3, page 2 of 2: 1"
+	if strings.Join(events, ", ") != expected {
+		t.Errorf("Expected %q but got %q", expected, strings.Join(events, ", "))
+	}
+}
+
+// benchmarkResponse renders a scroll response of n hits, each with a
+// _source of about size bytes.
+func benchmarkResponse(n, size int) []byte {
+	var b bytes.Buffer
+	b.WriteString(`{"_scroll_id":"abc","took":12,"timed_out":false,`)
+	b.WriteString(`"_shards":{"total":1,"successful":1,"skipped":0,"failed":0},`)
+	fmt.Fprintf(&b, `"hits":{"total":{"value":%d,"relation":"eq"},"max_score":null,"hits":[`, n)
+	text := strings.Repeat("lorem ipsum ", size/12)
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, `{"_index":"logs","_id":"%d","_seq_no":%d,"_primary_term":1,"_score":null,`, i, i)
+		fmt.Fprintf(&b, `"_source":{"id":%d,"level":"info","tags":["a","b"],"message":%q},"sort":[%d]}`, i, text, i)
+	}
+	b.WriteString(`]}}`)
+	return b.Bytes()
+}
+
+// parseTree is the decoder parseScrollResponse replaced: the whole response
+// is decoded into a map before the hits are taken out of it.
+func parseTree(body io.Reader) ([]Hit, error) {
+	result, err := decodeResponse(body)
+	if err != nil {
+		return nil, err
+	}
+	rawHits := result["hits"].(map[string]interface{})["hits"].([]interface{})
+	hits := make([]Hit, 0, len(rawHits))
+	for _, raw := range rawHits {
+		hit, err := newHit(raw)
+		if err != nil {
+			return nil, err
+		}
+		hits = append(hits, hit)
+	}
+	return hits, nil
+}
+
+// liveHeap returns the bytes in use on the heap after a collection.
+func liveHeap() int64 {
+	runtime.GC()
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	return int64(stats.HeapAlloc)
+}
+
+// BenchmarkParseResponse compares decoding a page of 500 hits of 4 KB into
+// a map first ("tree"), collecting them with the token decoder ("collect")
+// and streaming them one at a time ("stream"). Besides the allocations per
+// page it reports peak-live-B, the most memory held at once while the page
+// is handled: the whole page for tree and collect, one hit for stream.
+func BenchmarkParseResponse(b *testing.B) {
+	body := benchmarkResponse(500, 4<<10)
+
+	b.Run("tree", func(b *testing.B) {
+		b.ReportAllocs()
+		b.SetBytes(int64(len(body)))
+		for i := 0; i < b.N; i++ {
+			if _, err := parseTree(bytes.NewReader(body)); err != nil {
+				b.Fatal(err)
+			}
+		}
+		b.StopTimer()
+
+		base := liveHeap()
+		hits, _ := parseTree(bytes.NewReader(body))
+		b.ReportMetric(float64(liveHeap()-base), "peak-live-B")
+		runtime.KeepAlive(hits)
+	})
+
+	b.Run("collect", func(b *testing.B) {
+		b.ReportAllocs()
+		b.SetBytes(int64(len(body)))
+		for i := 0; i < b.N; i++ {
+			if _, err := parseScrollResponse(bytes.NewReader(body), nil); err != nil {
+				b.Fatal(err)
+			}
+		}
+		b.StopTimer()
+
+		base := liveHeap()
+		result, _ := parseScrollResponse(bytes.NewReader(body), nil)
+		b.ReportMetric(float64(liveHeap()-base), "peak-live-B")
+		runtime.KeepAlive(result)
+	})
+
+	b.Run("stream", func(b *testing.B) {
+		discard := func(Hit) error { return nil }
+		b.ReportAllocs()
+		b.SetBytes(int64(len(body)))
+		for i := 0; i < b.N; i++ {
+			if _, err := parseScrollResponse(bytes.NewReader(body), streamHits(discard)); err != nil {
+				b.Fatal(err)
+			}
+		}
+		b.StopTimer()
+
+		// Sample the live heap while every 50th hit is being handled.
+		var peak int64
+		base := liveHeap()
+		n := 0
+		parseScrollResponse(bytes.NewReader(body), streamHits(func(hit Hit) error {
+			if n++; n%50 == 0 {
+				if live := liveHeap() - base; live > peak {
+					peak = live
+				}
+			}
+			runtime.KeepAlive(hit)
+			return nil
+		}))
+		b.ReportMetric(float64(peak), "peak-live-B")
+	})
+}
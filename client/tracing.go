@@ -0,0 +1,49 @@
+// client/tracing.go
+package client
+
+import (
+	"context"
+	"errors"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/terenzio/ElasticSearchQuerier/client")
+
+// startSpan starts the span of a call to a Searcher fetching page of slice,
+// or releasing the slice's search context if page is 0.
+func startSpan(ctx context.Context, name string, slice, page int) (context.Context, trace.Span) {
+	attrs := []attribute.KeyValue{
+		attribute.String("db.system", "elasticsearch"),
+		attribute.Int("slice", slice),
+	}
+	if page > 0 {
+		attrs = append(attrs, attribute.Int("page", page))
+	}
+	return tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+}
+
+// endSpan ends span with the page result fetched, or the error err.
+func endSpan(span trace.Span, result *ScrollResult, err error) {
+	if result != nil {
+		span.SetAttributes(
+			attribute.Int("hits", result.Len()),
+			attribute.Int("malformed_hits", len(result.Malformed)),
+			attribute.Bool("recovered", result.Recovered),
+		)
+	}
+	recordError(span, err)
+	span.End()
+}
+
+// recordError marks span as failed with err, unless it was cancelled.
+func recordError(span trace.Span, err error) {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return
+	}
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
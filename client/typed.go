@@ -0,0 +1,75 @@
+// client/typed.go
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// Document is a hit whose _source has been decoded into T. The metadata of
+// the hit, such as ID, Index and Sort, is promoted from the embedded Hit,
+// whose own Source is left nil.
+type Document[T any] struct {
+	Hit
+	Source T `json:"_source"`
+}
+
+// typedSearcher is implemented by searchers whose hits can be decoded by a
+// hitDecoder other than the default.
+type typedSearcher interface {
+	setHitDecoder(decodeHit hitDecoder)
+}
+
+var (
+	_ typedSearcher = (*ESClient)(nil)
+	_ typedSearcher = (*PITClient)(nil)
+)
+
+// Iterate runs query on searcher and calls fn with every hit in turn, its
+// _source decoded straight off the response into T with encoding/json, so
+// no intermediate map is built. As with json.Unmarshal into an interface,
+// numbers in untyped fields of T are decoded as json.Number. A hit without
+// _source leaves Source at its zero value.
+//
+// A hit that has no _id or does not decode into T stops the iteration with
+// an error wrapping ErrMalformedHit. The search context is released when
+// Iterate returns.
+func Iterate[T any](ctx context.Context, searcher Searcher, query string, fn func(Document[T]) error) error {
+	typed, ok := searcher.(typedSearcher)
+	if !ok {
+		return fmt.Errorf("searcher %T cannot decode typed documents", searcher)
+	}
+	typed.setHitDecoder(documentDecoder(fn))
+
+	return runSlice(ctx, searcher, query, 0, Position{}, func(*Page) error { return nil })
+}
+
+// documentDecoder returns a hitDecoder passing each hit to fn as a
+// Document[T].
+func documentDecoder[T any](fn func(Document[T]) error) hitDecoder {
+	return func(dec *json.Decoder, result *ScrollResult) error {
+		var doc Document[T]
+		err := dec.Decode(&doc)
+		if doc.Sort != nil {
+			result.SearchAfter = doc.Sort
+		}
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) {
+			return fmt.Errorf("%w: document %s: %w", ErrMalformedHit, doc.ID, err)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to parse response: %w", err)
+		}
+		if doc.ID == "" {
+			return fmt.Errorf("%w: missing _id", ErrMalformedHit)
+		}
+
+		if err := fn(doc); err != nil {
+			return err
+		}
+		result.Streamed++
+		return nil
+	}
+}
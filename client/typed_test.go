@@ -0,0 +1,96 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v8"
+)
+
+type logEntry struct {
+	Message string   `json:"message"`
+	Level   string   `json:"level"`
+	Bytes   int64    `json:"bytes"`
+	Tags    []string `json:"tags"`
+}
+
+// newTypedSearcher returns a scroll client on a server answering the
+// initial search with hits and every scroll with an empty page.
+func newTypedSearcher(t *testing.T, hits string) Searcher {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Elastic-Product", "Elasticsearch")
+		w.Header().Set("Content-Type", "application/json")
+
+		switch {
+		case r.URL.Path == "/logs/_search":
+			fmt.Fprintf(w, `{"_scroll_id":"s1","hits":{"total":{"value":2},"hits":[%s]}}`, hits)
+		case r.Method == http.MethodDelete:
+			fmt.Fprint(w, `{"succeeded":true}`)
+		default:
+			fmt.Fprint(w, `{"_scroll_id":"s1","hits":{"hits":[]}}`)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	es, err := elasticsearch.NewClient(elasticsearch.Config{Addresses: []string{server.URL}})
+	if err != nil {
+		t.Fatalf("Error creating client: %s", err)
+	}
+	return NewESClient(es, time.Minute, 2, "logs")
+}
+
+func TestIterateDecodesDocuments(t *testing.T) {
+	searcher := newTypedSearcher(t, `
+		{"_index":"logs","_id":"1","_seq_no":7,"_primary_term":1,"sort":[1],
+		 "_source":{"message":"started","level":"info","bytes":9007199254740993,"tags":["a","b"]}},
+		{"_index":"logs","_id":"2","_routing":"r1","sort":[2]}`)
+
+	var docs []Document[logEntry]
+	err := Iterate(context.Background(), searcher, `{"query":{"match_all":{}}}`, func(doc Document[logEntry]) error {
+		docs = append(docs, doc)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Error iterating: %s", err)
+	}
+
+	if len(docs) != 2 {
+		t.Fatalf("Expected 2 documents but got %d", len(docs))
+	}
+	first := docs[0]
+	if first.ID != "1" || first.Index != "logs" || first.SeqNo == nil || *first.SeqNo != 7 {
+		t.Errorf("Expected metadata of document 1 but got %+v", first.Hit)
+	}
+	if first.Source.Message != "started" || first.Source.Bytes != 9007199254740993 || len(first.Source.Tags) != 2 {
+		t.Errorf("Expected decoded _source but got %+v", first.Source)
+	}
+	if first.Hit.Source != nil {
+		t.Errorf("Expected the untyped _source to be left nil but got %v", first.Hit.Source)
+	}
+	if docs[1].Routing != "r1" || docs[1].Source.Message != "" {
+		t.Errorf("Expected document 2 without _source but got %+v", docs[1])
+	}
+}
+
+func TestIterateStopsOnMalformedDocument(t *testing.T) {
+	searcher := newTypedSearcher(t, `
+		{"_index":"logs","_id":"1","_source":{"message":"ok"}},
+		{"_index":"logs","_id":"2","_source":{"message":42}}`)
+
+	var ids []string
+	err := Iterate(context.Background(), searcher, `{}`, func(doc Document[logEntry]) error {
+		ids = append(ids, doc.ID)
+		return nil
+	})
+	if !errors.Is(err, ErrMalformedHit) {
+		t.Errorf("Expected ErrMalformedHit but got %v", err)
+	}
+	if len(ids) != 1 || ids[0] != "1" {
+		t.Errorf("Expected only document 1 before the error but got %v", ids)
+	}
+}
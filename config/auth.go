@@ -0,0 +1,131 @@
+// config/auth.go
+package config
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/elastic/go-elasticsearch/v8"
+)
+
+// Authentication methods, in the order Elasticsearch gives them precedence.
+const (
+	AuthNone         = "none"
+	AuthBasic        = "basic"
+	AuthAPIKey       = "api_key"
+	AuthServiceToken = "service_token"
+)
+
+// AuthMethod returns the authentication method selected by c.
+func (c *Config) AuthMethod() string {
+	switch {
+	case c.APIKey != "" || c.APIKeyFile != "":
+		return AuthAPIKey
+	case c.ServiceToken != "" || c.ServiceTokenFile != "":
+		return AuthServiceToken
+	case c.Username != "":
+		return AuthBasic
+	}
+	return AuthNone
+}
+
+// validateAuth reports conflicting or incomplete credentials.
+func (c *Config) validateAuth(invalid func(format string, args ...interface{})) {
+	methods := 0
+	for _, set := range []bool{
+		c.APIKey != "" || c.APIKeyFile != "",
+		c.ServiceToken != "" || c.ServiceTokenFile != "",
+		c.Username != "" || c.Password != "" || c.PasswordFile != "",
+	} {
+		if set {
+			methods++
+		}
+	}
+	if methods > 1 {
+		invalid("only one of username/password, API key and service token may be set")
+	}
+
+	if c.Password != "" && c.PasswordFile != "" {
+		invalid("password and password file must not both be set")
+	}
+	if c.APIKey != "" && c.APIKeyFile != "" {
+		invalid("API key and API key file must not both be set")
+	}
+	if c.ServiceToken != "" && c.ServiceTokenFile != "" {
+		invalid("service token and service token file must not both be set")
+	}
+	if c.Username == "" && (c.Password != "" || c.PasswordFile != "") {
+		invalid("password is set without a username")
+	}
+}
+
+// applyAuth copies the credentials of c into esConfig, reading secrets
+// from their files.
+func (c *Config) applyAuth(esConfig *elasticsearch.Config) error {
+	if c.CloudID != "" {
+		esConfig.CloudID = c.CloudID
+		esConfig.Addresses = nil
+	}
+
+	switch c.AuthMethod() {
+	case AuthBasic:
+		password, err := secret(c.Password, c.PasswordFile)
+		if err != nil {
+			return fmt.Errorf("failed to read password: %w", err)
+		}
+		esConfig.Username = c.Username
+		esConfig.Password = password
+	case AuthAPIKey:
+		key, err := secret(c.APIKey, c.APIKeyFile)
+		if err != nil {
+			return fmt.Errorf("failed to read API key: %w", err)
+		}
+		esConfig.APIKey = encodeAPIKey(key)
+	case AuthServiceToken:
+		token, err := secret(c.ServiceToken, c.ServiceTokenFile)
+		if err != nil {
+			return fmt.Errorf("failed to read service token: %w", err)
+		}
+		esConfig.ServiceToken = token
+	}
+	return nil
+}
+
+// secret returns value, or the contents of path without the trailing
+// newline editors and "echo" leave behind.
+func secret(value, path string) (string, error) {
+	if path == "" {
+		return value, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	value = strings.TrimRight(string(data), "\r\n")
+	if value == "" {
+		return "", fmt.Errorf("%s is empty", path)
+	}
+	return value, nil
+}
+
+// ServeAuthToken returns the bearer token clients of the jobs API must
+// send, reading it from its file if one is set. It is empty if none is set.
+func (c *Config) ServeAuthToken() (string, error) {
+	token, err := secret(c.ServeToken, c.ServeTokenFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to read serve token: %w", err)
+	}
+	return token, nil
+}
+
+// encodeAPIKey accepts an API key either as "id:api_key", as returned in
+// the id and api_key fields of the create API key response, or already
+// base64-encoded as in its encoded field.
+func encodeAPIKey(key string) string {
+	if strings.Contains(key, ":") {
+		return base64.StdEncoding.EncodeToString([]byte(key))
+	}
+	return key
+}
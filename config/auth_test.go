@@ -0,0 +1,114 @@
+// config/auth_test.go
+package config
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNewESClientAuthentication(t *testing.T) {
+	var authorization string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+		w.Header().Set("X-Elastic-Product", "Elasticsearch")
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"version":{"number":"8.15.0"}}`))
+	}))
+	defer server.Close()
+
+	passwordFile := filepath.Join(t.TempDir(), "password")
+	if err := os.WriteFile(passwordFile, []byte("s3cret\n"), 0o600); err != nil {
+		t.Fatalf("Error writing password file: %s", err)
+	}
+
+	basic := func(user, password string) string {
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(user+":"+password))
+	}
+	tests := []struct {
+		name     string
+		apply    func(c *Config)
+		expected string
+	}{
+		{"none", func(c *Config) {}, ""},
+		{"basic", func(c *Config) { c.Username, c.Password = "elastic", "changeme" }, basic("elastic", "changeme")},
+		{"password file", func(c *Config) { c.Username, c.PasswordFile = "elastic", passwordFile }, basic("elastic", "s3cret")},
+		{"api key id:key", func(c *Config) { c.APIKey = "VuaCfGcBCdbkQm:ui2lp2axTNmsyakw9tvNnw" },
+			"APIKey " + base64.StdEncoding.EncodeToString([]byte("VuaCfGcBCdbkQm:ui2lp2axTNmsyakw9tvNnw"))},
+		{"api key encoded", func(c *Config) { c.APIKey = "VnVhQ2ZHY0JDZGJrUW0=" }, "APIKey VnVhQ2ZHY0JDZGJrUW0="},
+		{"service token", func(c *Config) { c.ServiceToken = "AAEAAWVsYXN0aWM" }, "Bearer AAEAAWVsYXN0aWM"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := Default()
+			cfg.ElasticsearchURL = server.URL
+			test.apply(cfg)
+			if err := cfg.Validate(); err != nil {
+				t.Fatalf("Error validating config: %s", err)
+			}
+
+			es, err := NewESClient(cfg)
+			if err != nil {
+				t.Fatalf("Error creating client: %s", err)
+			}
+			res, err := es.Info()
+			if err != nil {
+				t.Fatalf("Error sending request: %s", err)
+			}
+			res.Body.Close()
+
+			if authorization != test.expected {
+				t.Errorf("Expected Authorization %q but got %q", test.expected, authorization)
+			}
+		})
+	}
+}
+
+func TestValidateAuthConflicts(t *testing.T) {
+	cfg := Default()
+	cfg.Username = "elastic"
+	cfg.APIKey = "key"
+	cfg.ServiceToken = "token"
+	cfg.ServiceTokenFile = "token.txt"
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatalf("Expected conflicting credentials to be rejected")
+	}
+	for _, want := range []string{"only one of username/password, API key and service token", "service token and service token file"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected error to mention %q, got: %s", want, err)
+		}
+	}
+}
+
+func TestValidateServeToken(t *testing.T) {
+	tests := []struct {
+		listen, token string
+		valid         bool
+	}{
+		{"127.0.0.1:8080", "", true},
+		{"localhost:8080", "", true},
+		{"[::1]:8080", "", true},
+		{":8080", "", false},
+		{"0.0.0.0:8080", "", false},
+		{":8080", "s3cret", true},
+	}
+	for _, test := range tests {
+		cfg := Default()
+		cfg.Mode = "serve"
+		cfg.ListenAddr = test.listen
+		cfg.ServeToken = test.token
+		err := cfg.Validate()
+		if test.valid && err != nil {
+			t.Errorf("Expected %s with token %q to be valid, got: %s", test.listen, test.token, err)
+		}
+		if !test.valid && (err == nil || !strings.Contains(err.Error(), "serve token")) {
+			t.Errorf("Expected %s without a token to be rejected, got: %v", test.listen, err)
+		}
+	}
+}
@@ -2,50 +2,143 @@
 package config
 
 import (
-	"crypto/tls"
 	"net/http"
-	"os"
 	"time"
 
 	"github.com/elastic/go-elasticsearch/v8"
+
+	"github.com/terenzio/ElasticSearchQuerier/client"
+	"github.com/terenzio/ElasticSearchQuerier/tracing"
 )
 
+// Config holds the settings of a run. See settings.go for the config file
+// key, environment variable and flag of each field.
 type Config struct {
 	ElasticsearchURL string
+	CloudID          string
+	Username         string
+	Password         string
+	PasswordFile     string
+	APIKey           string
+	APIKeyFile       string
+	ServiceToken     string
+	ServiceTokenFile string
+	CACert           string
+	CAFingerprint    string
+	ClientCert       string
+	ClientKey        string
+	Insecure         bool
+	RetryInitial     time.Duration
+	RetryMax         time.Duration
+	RetryMaxElapsed  time.Duration
+	Mode             string
 	BatchSize        int
 	ScrollDuration   time.Duration
 	OutputPath       string
+	DeadLetterPath   string
+	QueryFile        string
+	ParamsFile       string
+	InputPath        string
+	ReportPath       string
+	ImportIndex      string
 	IndexName        string
+	PaginationMode   string
+	Workers          int
+	Stream           bool
+	CheckpointFile   string
+	CheckpointEvery  time.Duration
+	Sink             string
+	SinkMetadata     bool
+	Columns          []string
+	ArrayMode        string
+	ArraySeparator   string
+	RowGroupRows     int
+	MetricsAddr      string
+	TraceExporter    string
+	OTLPEndpoint     string
+	LogLevel         string
+	LogFormat        string
+	ListenAddr       string
+	ServeToken       string
+	ServeTokenFile   string
+	JobsDir          string
+	JobWorkers       int
+	JobQueue         int
+	JobRetention     time.Duration
+	JobHistory       int
 }
 
-func NewConfig() *Config {
+// Default returns the built-in configuration, before any config file,
+// environment variable or flag is applied.
+func Default() *Config {
 	return &Config{
-		ElasticsearchURL: getEnvWithDefault("ELASTICSEARCH_URL", "http://localhost:9200"),
+		ElasticsearchURL: "http://localhost:9200",
+		RetryInitial:     1 * time.Second,
+		RetryMax:         30 * time.Second,
+		RetryMaxElapsed:  5 * time.Minute,
+		Mode:             "export",
 		BatchSize:        6,
 		ScrollDuration:   time.Minute,
 		OutputPath:       "/app/data/logs.txt",
+		DeadLetterPath:   "/app/data/export_dead_letter.jsonl",
+		QueryFile:        "query.json",
+		InputPath:        "/app/data/export.ndjson",
+		ReportPath:       "/app/data/import_failures.jsonl",
 		IndexName:        "sample_data",
+		PaginationMode:   "scroll",
+		Workers:          1,
+		Stream:           true,
+		CheckpointEvery:  30 * time.Second,
+		Sink:             "file",
+		ArrayMode:        "join",
+		ArraySeparator:   "|",
+		RowGroupRows:     100000,
+		TraceExporter:    "none",
+		OTLPEndpoint:     "http://localhost:4318",
+		LogLevel:         "info",
+		LogFormat:        "text",
+		ListenAddr:       "127.0.0.1:8080",
+		JobsDir:          "/app/data/jobs",
+		JobWorkers:       2,
+		JobQueue:         100,
+		JobRetention:     24 * time.Hour,
+		JobHistory:       100,
 	}
 }
 
-func getEnvWithDefault(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
-	}
-	return defaultValue
+// NewConfig returns the defaults overridden by environment variables.
+// Environment values that do not parse are ignored; use Load to have them
+// reported.
+func NewConfig() *Config {
+	cfg := Default()
+	cfg.applyEnv()
+	return cfg
 }
 
 func NewESClient(cfg *Config) (*elasticsearch.Client, error) {
-	transport := &http.Transport{
-		TLSClientConfig: &tls.Config{
-			InsecureSkipVerify: true, // Note: Use with caution in production
-		},
+	tlsConfig, err := cfg.tlsConfig()
+	if err != nil {
+		return nil, err
 	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
 
 	esConfig := elasticsearch.Config{
 		Addresses: []string{cfg.ElasticsearchURL},
-		Transport: transport,
+		Transport: tracing.Transport(transport),
+	}
+	if err := cfg.applyAuth(&esConfig); err != nil {
+		return nil, err
 	}
 
 	return elasticsearch.NewClient(esConfig)
 }
+
+// RetryPolicy returns the retry settings of c.
+func (c *Config) RetryPolicy() client.RetryPolicy {
+	return client.RetryPolicy{
+		InitialInterval: c.RetryInitial,
+		MaxInterval:     c.RetryMax,
+		MaxElapsedTime:  c.RetryMaxElapsed,
+	}
+}
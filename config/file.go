@@ -0,0 +1,198 @@
+// config/file.go
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// Environment variables selecting the config file and profile when the
+// -config and -profile flags are not given.
+const (
+	EnvConfigFile    = "CONFIG_FILE"
+	EnvConfigProfile = "CONFIG_PROFILE"
+)
+
+// Load returns the configuration built, in increasing precedence, from the
+// defaults, the top-level settings of the config file at path, the settings
+// of the named profile in that file and the environment. path and profile
+// may be empty. The file is YAML or TOML depending on its extension:
+//
+//	index: logs-*
+//	batch_size: 500
+//	profiles:
+//	  prod:
+//	    elasticsearch_url: https://es.prod.example.com:9200
+//
+// Unknown keys, unknown profiles and values that do not parse are errors.
+func Load(path, profile string) (*Config, error) {
+	cfg := Default()
+
+	if path != "" {
+		if err := cfg.applyFile(path, profile); err != nil {
+			return nil, err
+		}
+	} else if profile != "" {
+		return nil, fmt.Errorf("profile %q selected without a config file", profile)
+	}
+
+	if errs := cfg.applyEnv(); len(errs) > 0 {
+		return nil, fmt.Errorf("invalid configuration:\n%w", errors.Join(errs...))
+	}
+	return cfg, nil
+}
+
+func (c *Config) applyFile(path, profile string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var doc map[string]interface{}
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &doc)
+	case ".toml":
+		err = toml.Unmarshal(data, &doc)
+	default:
+		return fmt.Errorf("config file %s: unsupported extension %q, use .yaml, .yml or .toml", path, ext)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	profiles, err := profileTable(doc["profiles"])
+	if err != nil {
+		return fmt.Errorf("config file %s: %w", path, err)
+	}
+	delete(doc, "profiles")
+
+	var errs []error
+	errs = append(errs, c.applyValues(doc, "")...)
+	if profile != "" {
+		values, ok := profiles[profile]
+		if !ok {
+			return fmt.Errorf("config file %s: unknown profile %q (available: %s)", path, profile, profileNames(profiles))
+		}
+		errs = append(errs, c.applyValues(values, "profiles."+profile+".")...)
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid config file %s:\n%w", path, errors.Join(errs...))
+	}
+	return nil
+}
+
+func profileTable(v interface{}) (map[string]map[string]interface{}, error) {
+	profiles := make(map[string]map[string]interface{})
+	if v == nil {
+		return profiles, nil
+	}
+	table, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("profiles must be a table of named profiles")
+	}
+	for name, p := range table {
+		values, ok := p.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("profile %q must be a table of settings", name)
+		}
+		profiles[name] = values
+	}
+	return profiles, nil
+}
+
+func profileNames(profiles map[string]map[string]interface{}) string {
+	if len(profiles) == 0 {
+		return "none"
+	}
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// applyValues sets the settings in values, in key order so errors are
+// reported deterministically. prefix qualifies keys in error messages.
+func (c *Config) applyValues(values map[string]interface{}, prefix string) []error {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var errs []error
+	for _, key := range keys {
+		s, ok := lookupSetting(key)
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s%s: unknown setting", prefix, key))
+			continue
+		}
+		value, err := scalarString(values[key])
+		if err == nil {
+			err = s.set(c, value)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s%s: %w", prefix, key, err))
+		}
+	}
+	return errs
+}
+
+// scalarString renders a decoded file value in the form the environment
+// variable of the setting would take. Lists become comma-separated.
+func scalarString(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case bool, int, int64, uint64, float64:
+		return fmt.Sprint(v), nil
+	case []interface{}:
+		items := make([]string, len(v))
+		for i, item := range v {
+			s, err := scalarString(item)
+			if err != nil {
+				return "", err
+			}
+			items[i] = s
+		}
+		return strings.Join(items, ","), nil
+	case nil:
+		return "", nil
+	}
+	return "", fmt.Errorf("unsupported value %v", v)
+}
+
+// WriteYAML writes the effective settings of c as a YAML config file, with
+// secrets masked.
+func (c *Config) WriteYAML(w io.Writer) error {
+	doc := &yaml.Node{Kind: yaml.MappingNode}
+	for _, s := range settings {
+		value := &yaml.Node{Kind: yaml.ScalarNode, Value: s.maskedValue(c)}
+		if list, ok := s.field(c).(*[]string); ok {
+			value = &yaml.Node{Kind: yaml.SequenceNode, Style: yaml.FlowStyle}
+			for _, item := range *list {
+				value.Content = append(value.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: item})
+			}
+		} else if _, ok := s.field(c).(*string); ok {
+			value.Tag = "!!str"
+		}
+		doc.Content = append(doc.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: s.Key}, value)
+	}
+
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(doc); err != nil {
+		return fmt.Errorf("failed to write configuration: %w", err)
+	}
+	return enc.Close()
+}
@@ -0,0 +1,290 @@
+// config/settings.go
+package config
+
+import (
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Setting describes one Config field: its key in config files, the
+// environment variable overriding it and the command-line flag overriding
+// both. Env or Flag is empty if the setting cannot be set that way. Secrets
+// have no flag, so they never show up in the process list; they are masked
+// when the configuration is printed.
+type Setting struct {
+	Key    string
+	Env    string
+	Flag   string
+	Usage  string
+	Secret bool
+	field  func(c *Config) interface{}
+}
+
+var settings = []Setting{
+	{Key: "elasticsearch_url", Env: "ELASTICSEARCH_URL", Flag: "es-url", Usage: "Elasticsearch URL",
+		field: func(c *Config) interface{} { return &c.ElasticsearchURL }},
+	{Key: "cloud_id", Env: "ELASTIC_CLOUD_ID", Flag: "cloud-id", Usage: "Elastic Cloud deployment ID, used instead of the URL",
+		field: func(c *Config) interface{} { return &c.CloudID }},
+	{Key: "username", Env: "ELASTICSEARCH_USERNAME", Flag: "username", Usage: "username for basic authentication",
+		field: func(c *Config) interface{} { return &c.Username }},
+	{Key: "password", Env: "ELASTICSEARCH_PASSWORD", Secret: true,
+		field: func(c *Config) interface{} { return &c.Password }},
+	{Key: "password_file", Env: "ELASTICSEARCH_PASSWORD_FILE", Flag: "password-file", Usage: "file containing the basic authentication password",
+		field: func(c *Config) interface{} { return &c.PasswordFile }},
+	{Key: "api_key", Env: "ELASTICSEARCH_API_KEY", Secret: true,
+		field: func(c *Config) interface{} { return &c.APIKey }},
+	{Key: "api_key_file", Env: "ELASTICSEARCH_API_KEY_FILE", Flag: "api-key-file", Usage: "file containing an API key, as id:api_key or encoded",
+		field: func(c *Config) interface{} { return &c.APIKeyFile }},
+	{Key: "service_token", Env: "ELASTICSEARCH_SERVICE_TOKEN", Secret: true,
+		field: func(c *Config) interface{} { return &c.ServiceToken }},
+	{Key: "service_token_file", Env: "ELASTICSEARCH_SERVICE_TOKEN_FILE", Flag: "service-token-file", Usage: "file containing a service account token",
+		field: func(c *Config) interface{} { return &c.ServiceTokenFile }},
+	{Key: "ca_cert", Env: "ELASTICSEARCH_CA_CERT", Flag: "ca-cert", Usage: "PEM file of CA certificates to trust",
+		field: func(c *Config) interface{} { return &c.CACert }},
+	{Key: "ca_fingerprint", Env: "ELASTICSEARCH_CA_FINGERPRINT", Flag: "ca-fingerprint", Usage: "SHA-256 fingerprint of the CA certificate to trust",
+		field: func(c *Config) interface{} { return &c.CAFingerprint }},
+	{Key: "client_cert", Env: "ELASTICSEARCH_CLIENT_CERT", Flag: "client-cert", Usage: "PEM client certificate for mutual TLS",
+		field: func(c *Config) interface{} { return &c.ClientCert }},
+	{Key: "client_key", Env: "ELASTICSEARCH_CLIENT_KEY", Flag: "client-key", Usage: "PEM private key of the client certificate",
+		field: func(c *Config) interface{} { return &c.ClientKey }},
+	{Key: "insecure", Env: "ELASTICSEARCH_INSECURE", Flag: "insecure", Usage: "skip TLS certificate verification (unsafe)",
+		field: func(c *Config) interface{} { return &c.Insecure }},
+	{Key: "retry_initial_interval", Env: "RETRY_INITIAL_INTERVAL", Flag: "retry-initial-interval", Usage: "delay before the first retry of a failed request",
+		field: func(c *Config) interface{} { return &c.RetryInitial }},
+	{Key: "retry_max_interval", Env: "RETRY_MAX_INTERVAL", Flag: "retry-max-interval", Usage: "longest delay between retries",
+		field: func(c *Config) interface{} { return &c.RetryMax }},
+	{Key: "retry_max_elapsed_time", Env: "RETRY_MAX_ELAPSED_TIME", Flag: "retry-max-elapsed-time", Usage: "how long to keep retrying a request, 0 for no limit",
+		field: func(c *Config) interface{} { return &c.RetryMaxElapsed }},
+	{Key: "index", Env: "INDEX_NAME", Flag: "index", Usage: "index name or pattern",
+		field: func(c *Config) interface{} { return &c.IndexName }},
+	{Key: "mode", Env: "MODE", Usage: "command run when none is given: export, import or serve",
+		field: func(c *Config) interface{} { return &c.Mode }},
+	{Key: "batch_size", Env: "BATCH_SIZE", Flag: "batch-size", Usage: "documents per page or bulk request",
+		field: func(c *Config) interface{} { return &c.BatchSize }},
+	{Key: "scroll_duration", Env: "SCROLL_DURATION", Flag: "scroll-duration", Usage: "scroll or point-in-time keep-alive",
+		field: func(c *Config) interface{} { return &c.ScrollDuration }},
+	{Key: "pagination_mode", Env: "PAGINATION_MODE", Flag: "pagination", Usage: "pagination mode: scroll or pit",
+		field: func(c *Config) interface{} { return &c.PaginationMode }},
+	{Key: "workers", Env: "WORKERS", Flag: "workers", Usage: "number of slices fetched concurrently",
+		field: func(c *Config) interface{} { return &c.Workers }},
+	{Key: "stream", Env: "STREAM_HITS", Flag: "stream", Usage: "with one worker, write each hit as it is read off the response",
+		field: func(c *Config) interface{} { return &c.Stream }},
+	{Key: "checkpoint_file", Env: "CHECKPOINT_FILE", Flag: "checkpoint", Usage: "file recording export progress for -resume",
+		field: func(c *Config) interface{} { return &c.CheckpointFile }},
+	{Key: "checkpoint_interval", Env: "CHECKPOINT_INTERVAL", Flag: "checkpoint-interval", Usage: "how often the checkpoint file is updated",
+		field: func(c *Config) interface{} { return &c.CheckpointEvery }},
+	{Key: "query_file", Env: "QUERY_FILE", Flag: "query-file", Usage: "path to the query template",
+		field: func(c *Config) interface{} { return &c.QueryFile }},
+	{Key: "params_file", Env: "PARAMS_FILE", Flag: "params-file", Usage: "JSON file with query parameter values",
+		field: func(c *Config) interface{} { return &c.ParamsFile }},
+	{Key: "sink", Env: "SINK", Flag: "sink", Usage: "output sink",
+		field: func(c *Config) interface{} { return &c.Sink }},
+	{Key: "output_path", Env: "OUTPUT_PATH", Flag: "output", Usage: `output path, "-" for standard output`,
+		field: func(c *Config) interface{} { return &c.OutputPath }},
+	{Key: "dead_letter_file", Env: "DEAD_LETTER_FILE", Flag: "dead-letter", Usage: "where to write hits that cannot be parsed, empty to only log them",
+		field: func(c *Config) interface{} { return &c.DeadLetterPath }},
+	{Key: "sink_metadata", Env: "SINK_METADATA", Flag: "metadata", Usage: "include hit metadata in sinks that support it",
+		field: func(c *Config) interface{} { return &c.SinkMetadata }},
+	{Key: "csv_columns", Env: "CSV_COLUMNS", Flag: "columns", Usage: "comma-separated dotted paths for csv/tsv output",
+		field: func(c *Config) interface{} { return &c.Columns }},
+	{Key: "csv_array_mode", Env: "CSV_ARRAY_MODE", Flag: "array-mode", Usage: "multi-value rendering for csv/tsv: join, json or first",
+		field: func(c *Config) interface{} { return &c.ArrayMode }},
+	{Key: "csv_array_separator", Env: "CSV_ARRAY_SEPARATOR", Flag: "array-separator", Usage: "separator for array mode join",
+		field: func(c *Config) interface{} { return &c.ArraySeparator }},
+	{Key: "parquet_row_group_rows", Env: "PARQUET_ROW_GROUP_ROWS", Flag: "row-group-rows", Usage: "rows per Parquet row group, which is also cut at 128 MiB",
+		field: func(c *Config) interface{} { return &c.RowGroupRows }},
+	{Key: "input_path", Env: "INPUT_PATH", Flag: "input", Usage: "_bulk NDJSON file to import",
+		field: func(c *Config) interface{} { return &c.InputPath }},
+	{Key: "report_path", Env: "REPORT_PATH", Flag: "report", Usage: "where to write the import items that failed",
+		field: func(c *Config) interface{} { return &c.ReportPath }},
+	{Key: "import_index", Env: "IMPORT_INDEX", Flag: "import-index", Usage: "index to import every document into, empty to keep the _index recorded in the file",
+		field: func(c *Config) interface{} { return &c.ImportIndex }},
+	{Key: "metrics_addr", Env: "METRICS_ADDR", Flag: "metrics-addr", Usage: "address to serve Prometheus metrics on, such as :9090; empty to disable",
+		field: func(c *Config) interface{} { return &c.MetricsAddr }},
+	{Key: "trace_exporter", Env: "TRACE_EXPORTER", Flag: "trace-exporter", Usage: "where to send trace spans: none, stdout (written to standard error) or otlp",
+		field: func(c *Config) interface{} { return &c.TraceExporter }},
+	{Key: "otlp_endpoint", Env: "OTLP_ENDPOINT", Flag: "otlp-endpoint", Usage: "OTLP/HTTP collector for trace exporter otlp",
+		field: func(c *Config) interface{} { return &c.OTLPEndpoint }},
+	{Key: "log_level", Env: "LOG_LEVEL", Flag: "log-level", Usage: "least severe messages to log: debug, info, warn or error",
+		field: func(c *Config) interface{} { return &c.LogLevel }},
+	{Key: "log_format", Env: "LOG_FORMAT", Flag: "log-format", Usage: "log record format: text or json",
+		field: func(c *Config) interface{} { return &c.LogFormat }},
+	{Key: "listen_addr", Env: "LISTEN_ADDR", Flag: "listen", Usage: "address serve listens on for the jobs API",
+		field: func(c *Config) interface{} { return &c.ListenAddr }},
+	{Key: "serve_token", Env: "SERVE_TOKEN", Secret: true,
+		field: func(c *Config) interface{} { return &c.ServeToken }},
+	{Key: "serve_token_file", Env: "SERVE_TOKEN_FILE", Flag: "serve-token-file", Usage: "file containing the bearer token clients of the jobs API must send",
+		field: func(c *Config) interface{} { return &c.ServeTokenFile }},
+	{Key: "jobs_dir", Env: "JOBS_DIR", Flag: "jobs-dir", Usage: "directory serve writes job results to",
+		field: func(c *Config) interface{} { return &c.JobsDir }},
+	{Key: "job_workers", Env: "JOB_WORKERS", Flag: "job-workers", Usage: "export jobs serve runs at once",
+		field: func(c *Config) interface{} { return &c.JobWorkers }},
+	{Key: "job_queue", Env: "JOB_QUEUE", Flag: "job-queue", Usage: "jobs serve holds waiting for a worker before turning submissions away",
+		field: func(c *Config) interface{} { return &c.JobQueue }},
+	{Key: "job_retention", Env: "JOB_RETENTION", Flag: "job-retention", Usage: "how long serve keeps finished jobs and their results, 0 for no limit",
+		field: func(c *Config) interface{} { return &c.JobRetention }},
+	{Key: "job_history", Env: "JOB_HISTORY", Flag: "job-history", Usage: "finished jobs serve keeps, deleting the oldest and their results beyond it",
+		field: func(c *Config) interface{} { return &c.JobHistory }},
+}
+
+// Settings returns the description of every setting, in display order.
+func Settings() []Setting {
+	return append([]Setting(nil), settings...)
+}
+
+func lookupSetting(key string) (Setting, bool) {
+	for _, s := range settings {
+		if s.Key == key {
+			return s, true
+		}
+	}
+	return Setting{}, false
+}
+
+// set parses value into the setting's field of c.
+func (s Setting) set(c *Config, value string) error {
+	switch p := s.field(c).(type) {
+	case *string:
+		*p = value
+	case *int:
+		n, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil {
+			return fmt.Errorf("%q is not an integer", value)
+		}
+		*p = n
+	case *bool:
+		b, err := strconv.ParseBool(strings.TrimSpace(value))
+		if err != nil {
+			return fmt.Errorf("%q is not a boolean", value)
+		}
+		*p = b
+	case *time.Duration:
+		d, err := time.ParseDuration(strings.TrimSpace(value))
+		if err != nil {
+			return fmt.Errorf("%q is not a duration such as 30s or 5m", value)
+		}
+		*p = d
+	case *[]string:
+		*p = splitList(value)
+	default:
+		panic("config: unsupported field type for " + s.Key)
+	}
+	return nil
+}
+
+// get renders the setting's field of c as a string.
+func (s Setting) get(c *Config) string {
+	switch p := s.field(c).(type) {
+	case *string:
+		return *p
+	case *int:
+		return strconv.Itoa(*p)
+	case *bool:
+		return strconv.FormatBool(*p)
+	case *time.Duration:
+		return p.String()
+	case *[]string:
+		return strings.Join(*p, ",")
+	}
+	return ""
+}
+
+func splitList(value string) []string {
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// applyEnv overrides c with the environment and returns the variables that
+// could not be parsed. Empty variables are treated as unset.
+func (c *Config) applyEnv() []error {
+	var errs []error
+	for _, s := range settings {
+		if s.Env == "" {
+			continue
+		}
+		if value := os.Getenv(s.Env); value != "" {
+			if err := s.set(c, value); err != nil {
+				errs = append(errs, fmt.Errorf("environment variable %s: %w", s.Env, err))
+			}
+		}
+	}
+	return errs
+}
+
+// BindFlags defines a flag on fs for each named setting, with the current
+// value of c as its default. Flags are bound for every setting that has one
+// if no names are given.
+func (c *Config) BindFlags(fs *flag.FlagSet, names ...string) {
+	for _, s := range settings {
+		if s.Flag == "" || (len(names) > 0 && !contains(names, s.Flag)) {
+			continue
+		}
+		switch p := s.field(c).(type) {
+		case *string:
+			fs.StringVar(p, s.Flag, *p, s.Usage)
+		case *int:
+			fs.IntVar(p, s.Flag, *p, s.Usage)
+		case *bool:
+			fs.BoolVar(p, s.Flag, *p, s.Usage)
+		case *time.Duration:
+			fs.DurationVar(p, s.Flag, *p, s.Usage)
+		default:
+			fs.Var(settingValue{s, c}, s.Flag, s.Usage)
+		}
+	}
+}
+
+// settingValue adapts a setting to flag.Value.
+type settingValue struct {
+	s Setting
+	c *Config
+}
+
+func (v settingValue) String() string {
+	if v.c == nil {
+		return ""
+	}
+	return v.s.get(v.c)
+}
+
+func (v settingValue) Set(value string) error { return v.s.set(v.c, value) }
+
+func contains(list []string, item string) bool {
+	for _, x := range list {
+		if x == item {
+			return true
+		}
+	}
+	return false
+}
+
+// maskedValue returns the value of s in c in a form safe to print: secrets
+// are replaced by "********" and URL passwords by "xxxxx".
+func (s Setting) maskedValue(c *Config) string {
+	value := s.get(c)
+	switch {
+	case s.Secret && value != "":
+		return "********"
+	case strings.HasSuffix(s.Key, "_url"):
+		return maskURL(value)
+	}
+	return value
+}
+
+func maskURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return raw
+	}
+	return u.Redacted()
+}
@@ -0,0 +1,263 @@
+// config/tls_test.go
+package config
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTLSServer(t *testing.T, configure func(*tls.Config)) *httptest.Server {
+	t.Helper()
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Elastic-Product", "Elasticsearch")
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"version":{"number":"8.15.0"}}`))
+	}))
+	server.TLS = &tls.Config{}
+	if configure != nil {
+		configure(server.TLS)
+	}
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	return server
+}
+
+// writePEM writes blocks of the given type to a temporary file.
+func writePEM(t *testing.T, name, blockType string, der []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600); err != nil {
+		t.Fatalf("Error writing %s: %s", name, err)
+	}
+	return path
+}
+
+// newClientCert creates a self-signed client certificate and returns it with
+// the paths of its PEM certificate and key.
+func newClientCert(t *testing.T) (*x509.Certificate, string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Error generating key: %s", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "querier"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Error creating certificate: %s", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("Error parsing certificate: %s", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("Error encoding key: %s", err)
+	}
+	return cert, writePEM(t, "client.pem", "CERTIFICATE", der), writePEM(t, "client-key.pem", "EC PRIVATE KEY", keyDER)
+}
+
+// newCert creates a certificate for template signed by parent, or
+// self-signed if parent is nil, and returns it with its key.
+func newCert(t *testing.T, template, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Error generating key: %s", err)
+	}
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatalf("Error creating certificate: %s", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("Error parsing certificate: %s", err)
+	}
+	return cert, key
+}
+
+func ping(cfg *Config) error {
+	es, err := NewESClient(cfg)
+	if err != nil {
+		return err
+	}
+	res, err := es.Info()
+	if err != nil {
+		return err
+	}
+	return res.Body.Close()
+}
+
+func TestNewESClientTLS(t *testing.T) {
+	server := newTLSServer(t, nil)
+	caCert := writePEM(t, "ca.pem", "CERTIFICATE", server.Certificate().Raw)
+	sum := sha256.Sum256(server.Certificate().Raw)
+	fingerprint := hex.EncodeToString(sum[:])
+
+	var colons []string
+	for i := 0; i < len(fingerprint); i += 2 {
+		colons = append(colons, strings.ToUpper(fingerprint[i:i+2]))
+	}
+
+	tests := []struct {
+		name    string
+		apply   func(c *Config)
+		success bool
+	}{
+		{"verified by default", func(c *Config) {}, false},
+		{"CA certificate", func(c *Config) { c.CACert = caCert }, true},
+		{"fingerprint", func(c *Config) { c.CAFingerprint = fingerprint }, true},
+		{"fingerprint with colons", func(c *Config) { c.CAFingerprint = strings.Join(colons, ":") }, true},
+		{"wrong fingerprint", func(c *Config) { c.CAFingerprint = strings.Repeat("ab", 32) }, false},
+		{"insecure", func(c *Config) { c.Insecure = true }, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := Default()
+			cfg.ElasticsearchURL = server.URL
+			test.apply(cfg)
+			if err := cfg.Validate(); err != nil {
+				t.Fatalf("Error validating config: %s", err)
+			}
+
+			err := ping(cfg)
+			if test.success && err != nil {
+				t.Errorf("Expected request to succeed, got: %s", err)
+			}
+			if !test.success && err == nil {
+				t.Errorf("Expected request to fail certificate verification")
+			}
+		})
+	}
+}
+
+func TestNewESClientPinnedCA(t *testing.T) {
+	ca, caKey := newCert(t, &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Elasticsearch security auto-configuration HTTP CA"},
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}, nil, nil)
+	sum := sha256.Sum256(ca.Raw)
+	fingerprint := hex.EncodeToString(sum[:])
+
+	leaf := func(serial int64, ip string) *x509.Certificate {
+		return &x509.Certificate{
+			SerialNumber: big.NewInt(serial),
+			Subject:      pkix.Name{CommonName: "es01"},
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+			IPAddresses:  []net.IP{net.ParseIP(ip)},
+		}
+	}
+
+	tests := []struct {
+		name    string
+		cert    func() (*x509.Certificate, *ecdsa.PrivateKey)
+		success bool
+	}{
+		{"issued by the pinned CA", func() (*x509.Certificate, *ecdsa.PrivateKey) {
+			return newCert(t, leaf(2, "127.0.0.1"), ca, caKey)
+		}, true},
+		// The CA certificate is public, so anyone can append it to a chain
+		{"unrelated leaf presented with the pinned CA", func() (*x509.Certificate, *ecdsa.PrivateKey) {
+			return newCert(t, leaf(3, "127.0.0.1"), nil, nil)
+		}, false},
+		{"issued by the pinned CA for another host", func() (*x509.Certificate, *ecdsa.PrivateKey) {
+			return newCert(t, leaf(4, "192.0.2.1"), ca, caKey)
+		}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cert, key := test.cert()
+			server := newTLSServer(t, func(c *tls.Config) {
+				c.Certificates = []tls.Certificate{{Certificate: [][]byte{cert.Raw, ca.Raw}, PrivateKey: key}}
+			})
+
+			cfg := Default()
+			cfg.ElasticsearchURL = server.URL
+			cfg.CAFingerprint = fingerprint
+			err := ping(cfg)
+			if test.success && err != nil {
+				t.Errorf("Expected request to succeed, got: %s", err)
+			}
+			if !test.success && err == nil {
+				t.Errorf("Expected request to fail certificate verification")
+			}
+		})
+	}
+}
+
+func TestNewESClientMutualTLS(t *testing.T) {
+	clientCert, certFile, keyFile := newClientCert(t)
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientCert)
+
+	server := newTLSServer(t, func(c *tls.Config) {
+		c.ClientAuth = tls.RequireAndVerifyClientCert
+		c.ClientCAs = clientCAs
+	})
+	caCert := writePEM(t, "ca.pem", "CERTIFICATE", server.Certificate().Raw)
+
+	cfg := Default()
+	cfg.ElasticsearchURL = server.URL
+	cfg.CACert = caCert
+	if err := ping(cfg); err == nil {
+		t.Errorf("Expected request without client certificate to fail")
+	}
+
+	cfg.ClientCert = certFile
+	cfg.ClientKey = keyFile
+	if err := ping(cfg); err != nil {
+		t.Errorf("Expected request with client certificate to succeed, got: %s", err)
+	}
+}
+
+func TestValidateTLS(t *testing.T) {
+	cfg := Default()
+	cfg.ClientCert = "client.pem"
+	cfg.CAFingerprint = "not-hex"
+	cfg.CACert = "ca.pem"
+	cfg.Insecure = true
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatalf("Expected invalid TLS settings to be rejected")
+	}
+	for _, want := range []string{"client certificate and client key", "not a hex SHA-256 fingerprint", "insecure mode must not be combined",
+		"CA certificate and CA fingerprint must not be set together"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected error to mention %q, got: %s", want, err)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+// config/validate.go
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+
+	"github.com/terenzio/ElasticSearchQuerier/logging"
+	"github.com/terenzio/ElasticSearchQuerier/tracing"
+)
+
+// Validate reports every invalid setting at once, one per line.
+func (c *Config) Validate() error {
+	var errs []error
+	invalid := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	if c.CloudID == "" {
+		if u, err := url.Parse(c.ElasticsearchURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			invalid("elasticsearch URL %q must be an http:// or https:// URL", maskURL(c.ElasticsearchURL))
+		}
+	}
+	c.validateAuth(invalid)
+	c.validateTLS(invalid)
+	if c.RetryInitial <= 0 || c.RetryMax < c.RetryInitial {
+		invalid("retry intervals must be positive with the maximum at least the initial one, got %s and %s", c.RetryInitial, c.RetryMax)
+	}
+	if c.RetryMaxElapsed < 0 {
+		invalid("retry max elapsed time must not be negative, got %s", c.RetryMaxElapsed)
+	}
+	if c.IndexName == "" {
+		invalid("index name must not be empty")
+	}
+	if c.Mode != "export" && c.Mode != "import" && c.Mode != "serve" {
+		invalid("mode %q must be export, import or serve", c.Mode)
+	}
+	if c.BatchSize < 1 {
+		invalid("batch size must be at least 1, got %d", c.BatchSize)
+	}
+	if c.ScrollDuration <= 0 {
+		invalid("scroll duration must be positive, got %s", c.ScrollDuration)
+	}
+	if c.PaginationMode != "scroll" && c.PaginationMode != "pit" {
+		invalid("pagination mode %q must be scroll or pit", c.PaginationMode)
+	}
+	if c.Workers < 1 {
+		invalid("workers must be at least 1, got %d", c.Workers)
+	}
+	if c.CheckpointFile != "" {
+		if c.PaginationMode != "pit" {
+			invalid("checkpoints require pagination mode pit, since a scroll cannot be resumed")
+		}
+		if c.OutputPath == "-" {
+			invalid("checkpoints require an output file, not standard output")
+		}
+	}
+	if c.CheckpointEvery < 0 {
+		invalid("checkpoint interval must not be negative, got %s", c.CheckpointEvery)
+	}
+	if c.Sink == "" {
+		invalid("sink must not be empty")
+	}
+	switch c.ArrayMode {
+	case "join", "json", "first":
+	default:
+		invalid("array mode %q must be join, json or first", c.ArrayMode)
+	}
+	if c.RowGroupRows < 1 {
+		invalid("parquet row group rows must be at least 1, got %d", c.RowGroupRows)
+	}
+	switch c.TraceExporter {
+	case tracing.ExporterNone, tracing.ExporterStdout:
+	case tracing.ExporterOTLP:
+		if u, err := url.Parse(c.OTLPEndpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			invalid("OTLP endpoint %q must be an http:// or https:// URL", c.OTLPEndpoint)
+		}
+	default:
+		invalid("trace exporter %q must be none, stdout or otlp", c.TraceExporter)
+	}
+	if c.JobWorkers < 1 {
+		invalid("job workers must be at least 1, got %d", c.JobWorkers)
+	}
+	if c.JobQueue < 0 {
+		invalid("job queue must not be negative, got %d", c.JobQueue)
+	}
+	if c.JobRetention < 0 {
+		invalid("job retention must not be negative, got %s", c.JobRetention)
+	}
+	if c.JobHistory < 1 {
+		invalid("job history must be at least 1, got %d", c.JobHistory)
+	}
+	if c.ServeToken != "" && c.ServeTokenFile != "" {
+		invalid("serve token and serve token file must not both be set")
+	}
+	if c.Mode == "serve" && c.ServeToken == "" && c.ServeTokenFile == "" && !isLoopback(c.ListenAddr) {
+		invalid("listen address %q is not a loopback address, so a serve token or serve token file is required", c.ListenAddr)
+	}
+	if _, err := logging.ParseLevel(c.LogLevel); err != nil {
+		invalid("log level %q must be debug, info, warn or error", c.LogLevel)
+	}
+	if c.LogFormat != logging.FormatText && c.LogFormat != logging.FormatJSON {
+		invalid("log format %q must be text or json", c.LogFormat)
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid configuration:\n%w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// isLoopback reports whether addr only accepts connections from this host.
+func isLoopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,340 @@
+// estest/query.go
+package estest
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// matcher is a parsed query.
+type matcher interface {
+	match(d *doc) bool
+}
+
+type matchAll struct{}
+
+func (matchAll) match(*doc) bool { return true }
+
+// termQuery matches documents whose field equals one of values.
+type termQuery struct {
+	field  string
+	values []interface{}
+}
+
+func (q termQuery) match(d *doc) bool {
+	for _, have := range fieldValues(d, q.field) {
+		for _, want := range q.values {
+			if compare(have, want) == 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// rangeQuery matches documents with a field value within the bounds.
+type rangeQuery struct {
+	field  string
+	bounds map[string]interface{}
+}
+
+func (q rangeQuery) match(d *doc) bool {
+	for _, v := range fieldValues(d, q.field) {
+		ok := true
+		for op, bound := range q.bounds {
+			c := compare(v, bound)
+			switch op {
+			case "gt":
+				ok = ok && c > 0
+			case "gte":
+				ok = ok && c >= 0
+			case "lt":
+				ok = ok && c < 0
+			case "lte":
+				ok = ok && c <= 0
+			}
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+type boolQuery struct {
+	must    []matcher
+	mustNot []matcher
+}
+
+func (q boolQuery) match(d *doc) bool {
+	for _, m := range q.must {
+		if !m.match(d) {
+			return false
+		}
+	}
+	for _, m := range q.mustNot {
+		if m.match(d) {
+			return false
+		}
+	}
+	return true
+}
+
+// parseQuery parses the query clause of a search. An absent query matches
+// every document.
+func parseQuery(raw json.RawMessage) (matcher, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return matchAll{}, nil
+	}
+	var clause map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &clause); err != nil {
+		return nil, fmt.Errorf("malformed query: %w", err)
+	}
+	if len(clause) != 1 {
+		return nil, fmt.Errorf("query must have exactly one clause, got %d", len(clause))
+	}
+
+	for name, body := range clause {
+		switch name {
+		case "match_all":
+			return matchAll{}, nil
+		case "term", "terms":
+			return parseTerm(name, body)
+		case "range":
+			var fields map[string]map[string]interface{}
+			if err := unmarshal(body, &fields); err != nil || len(fields) != 1 {
+				return nil, fmt.Errorf("malformed range query")
+			}
+			for field, bounds := range fields {
+				return rangeQuery{field: field, bounds: bounds}, nil
+			}
+		case "bool":
+			return parseBool(body)
+		}
+		return nil, fmt.Errorf("unknown query [%s]", name)
+	}
+	return nil, nil
+}
+
+func parseTerm(name string, body json.RawMessage) (matcher, error) {
+	var fields map[string]interface{}
+	if err := unmarshal(body, &fields); err != nil || len(fields) != 1 {
+		return nil, fmt.Errorf("malformed %s query", name)
+	}
+	for field, value := range fields {
+		if object, ok := value.(map[string]interface{}); ok && name == "term" {
+			value = object["value"]
+		}
+		values, ok := value.([]interface{})
+		if name == "terms" && !ok {
+			return nil, fmt.Errorf("terms query on %s needs an array", field)
+		}
+		if name == "term" {
+			values = []interface{}{value}
+		}
+		return termQuery{field: field, values: values}, nil
+	}
+	return nil, nil
+}
+
+func parseBool(body json.RawMessage) (matcher, error) {
+	var clauses map[string]json.RawMessage
+	if err := json.Unmarshal(body, &clauses); err != nil {
+		return nil, fmt.Errorf("malformed bool query: %w", err)
+	}
+	var q boolQuery
+	for occur, raw := range clauses {
+		var list []json.RawMessage
+		if err := json.Unmarshal(raw, &list); err != nil {
+			list = []json.RawMessage{raw}
+		}
+		for _, item := range list {
+			m, err := parseQuery(item)
+			if err != nil {
+				return nil, err
+			}
+			switch occur {
+			case "must", "filter":
+				q.must = append(q.must, m)
+			case "must_not":
+				q.mustNot = append(q.mustNot, m)
+			default:
+				return nil, fmt.Errorf("unsupported bool clause [%s]", occur)
+			}
+		}
+	}
+	return q, nil
+}
+
+// sortField is one field of a sort, with _doc and _shard_doc standing for
+// the order documents were stored in.
+type sortField struct {
+	field string
+	desc  bool
+}
+
+// parseSort parses a sort given as a field name, an object or a list of
+// either.
+func parseSort(raw json.RawMessage) ([]sortField, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+	var list []json.RawMessage
+	if err := json.Unmarshal(raw, &list); err != nil {
+		list = []json.RawMessage{raw}
+	}
+
+	var fields []sortField
+	for _, item := range list {
+		var name string
+		if json.Unmarshal(item, &name) == nil {
+			fields = append(fields, sortField{field: name})
+			continue
+		}
+		var object map[string]interface{}
+		if err := json.Unmarshal(item, &object); err != nil || len(object) != 1 {
+			return nil, fmt.Errorf("malformed sort %s", item)
+		}
+		for name, order := range object {
+			if options, ok := order.(map[string]interface{}); ok {
+				order = options["order"]
+			}
+			fields = append(fields, sortField{field: name, desc: order == "desc"})
+		}
+	}
+	return fields, nil
+}
+
+// sortValues returns the sort values of d, as sent in a hit's "sort".
+func sortValues(d *doc, fields []sortField) []interface{} {
+	values := make([]interface{}, len(fields))
+	for i, f := range fields {
+		if f.field == "_doc" || f.field == "_shard_doc" {
+			values[i] = d.seq
+			continue
+		}
+		if v := fieldValues(d, f.field); len(v) > 0 {
+			values[i] = v[0]
+		}
+	}
+	return values
+}
+
+// compareDocs orders a before b by fields, then by storage order.
+func compareDocs(a, b *doc, fields []sortField) int {
+	av, bv := sortValues(a, fields), sortValues(b, fields)
+	for i, f := range fields {
+		if c := compare(av[i], bv[i]); c != 0 {
+			if f.desc {
+				return -c
+			}
+			return c
+		}
+	}
+	return compare(a.seq, b.seq)
+}
+
+func sortDocs(docs []*doc, fields []sortField) {
+	sort.SliceStable(docs, func(i, j int) bool {
+		return compareDocs(docs[i], docs[j], fields) < 0
+	})
+}
+
+// after returns the documents of sorted docs that come after searchAfter.
+func after(docs []*doc, fields []sortField, searchAfter []interface{}) []*doc {
+	for i, d := range docs {
+		values := sortValues(d, fields)
+		c := 0
+		for j, f := range fields {
+			if j >= len(searchAfter) {
+				break
+			}
+			if c = compare(values[j], searchAfter[j]); c != 0 {
+				if f.desc {
+					c = -c
+				}
+				break
+			}
+		}
+		if c > 0 {
+			return docs[i:]
+		}
+	}
+	return nil
+}
+
+// fieldValues returns the values of a dotted field path in the document,
+// flattening arrays. "_id" is the document ID.
+func fieldValues(d *doc, field string) []interface{} {
+	if field == "_id" {
+		return []interface{}{d.id}
+	}
+	values := []interface{}{map[string]interface{}(d.source)}
+	for _, key := range strings.Split(field, ".") {
+		var next []interface{}
+		for _, v := range values {
+			object, ok := v.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			switch child := object[key].(type) {
+			case nil:
+			case []interface{}:
+				next = append(next, child...)
+			default:
+				next = append(next, child)
+			}
+		}
+		values = next
+	}
+	return values
+}
+
+// compare orders two JSON values: numbers numerically, anything else by
+// its string form, and missing values last.
+func compare(a, b interface{}) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return 1
+	case b == nil:
+		return -1
+	}
+	if x, ok := number(a); ok {
+		if y, ok := number(b); ok {
+			switch {
+			case x < y:
+				return -1
+			case x > y:
+				return 1
+			}
+			return 0
+		}
+	}
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
+
+func number(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// unmarshal decodes raw keeping numbers as json.Number.
+func unmarshal(raw json.RawMessage, v interface{}) error {
+	dec := json.NewDecoder(strings.NewReader(string(raw)))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
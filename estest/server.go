@@ -0,0 +1,650 @@
+// estest/server.go
+
+// Package estest provides an in-process fake Elasticsearch for tests. It
+// serves the APIs this module uses — search with scroll, point in time and
+// search_after, sliced searches, _count, _bulk and _mapping — over an
+// in-memory set of documents, and can inject the faults a real cluster
+// produces: rejections, slow responses, expired search contexts and shard
+// failures.
+//
+// Queries support match_all, term, terms, range and bool with must, filter
+// and must_not; anything else is rejected with a 400 so that a test does not
+// silently pass on a query the fake does not understand.
+package estest
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v8"
+)
+
+// Endpoints, as named for Fail and Requests.
+const (
+	Search      = "search"
+	Scroll      = "scroll"
+	ClearScroll = "clear_scroll"
+	OpenPIT     = "open_pit"
+	ClosePIT    = "close_pit"
+	Count       = "count"
+	Bulk        = "bulk"
+	Mapping     = "mapping"
+)
+
+// Fault is an injected failure. A fault with a Status answers with an error
+// response; otherwise the request is served, after Delay, with the partial
+// results described by FailedShards and TimedOut.
+type Fault struct {
+	// Status and Type make the request fail with an error of that status
+	// and error.type.
+	Status int
+	Type   string
+	// RetryAfter is sent as the Retry-After header of an error.
+	RetryAfter string
+	// Delay holds the response back, or until the client gives up.
+	Delay time.Duration
+	// FailedShards and TimedOut mark a search response as incomplete.
+	FailedShards int
+	TimedOut     bool
+}
+
+// Common faults.
+var (
+	Rejected       = Fault{Status: http.StatusTooManyRequests, Type: "es_rejected_execution_exception"}
+	Unavailable    = Fault{Status: http.StatusServiceUnavailable, Type: "cluster_block_exception"}
+	ContextMissing = Fault{Status: http.StatusNotFound, Type: "search_context_missing_exception"}
+	ShardFailure   = Fault{FailedShards: 1}
+)
+
+// Doc is a stored document.
+type Doc struct {
+	ID     string
+	Source map[string]interface{}
+}
+
+// doc is a document as stored, with the sequence number that _doc and
+// _shard_doc sort on.
+type doc struct {
+	index  string
+	id     string
+	seq    int64
+	source map[string]interface{}
+}
+
+// cursor is an open scroll or point in time: the documents it sees and, for
+// a scroll, how far it has got.
+type cursor struct {
+	docs   []*doc
+	sort   []sortField
+	size   int
+	offset int
+	seqNo  bool
+}
+
+// Server is a fake Elasticsearch cluster. It is safe for concurrent use.
+type Server struct {
+	*httptest.Server
+	t testing.TB
+
+	mu       sync.Mutex
+	indices  map[string][]*doc
+	mappings map[string]map[string]interface{}
+	seq      int64
+	contexts map[string]*cursor
+	nextID   int
+	faults   map[string][]Fault
+	requests map[string]int
+}
+
+// New starts a server that is closed when the test ends.
+func New(t testing.TB) *Server {
+	s := &Server{
+		t:        t,
+		indices:  make(map[string][]*doc),
+		mappings: make(map[string]map[string]interface{}),
+		contexts: make(map[string]*cursor),
+		faults:   make(map[string][]Fault),
+		requests: make(map[string]int),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Client returns an Elasticsearch client for the server that does not retry
+// on its own, leaving retries to the code under test.
+func (s *Server) Client() *elasticsearch.Client {
+	es, err := elasticsearch.NewClient(elasticsearch.Config{
+		Addresses:    []string{s.URL},
+		DisableRetry: true,
+	})
+	if err != nil {
+		s.t.Fatalf("Error creating client: %s", err)
+	}
+	return es
+}
+
+// Index stores docs in index, replacing documents with the same ID.
+func (s *Server) Index(index string, docs ...Doc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, d := range docs {
+		s.put(index, d.ID, d.Source)
+	}
+}
+
+func (s *Server) put(index, id string, source map[string]interface{}) {
+	s.seq++
+	stored := &doc{index: index, id: id, seq: s.seq, source: source}
+	for i, existing := range s.indices[index] {
+		if existing.id == id {
+			s.indices[index][i] = stored
+			return
+		}
+	}
+	s.indices[index] = append(s.indices[index], stored)
+}
+
+// Docs returns the documents of index in the order they were stored.
+func (s *Server) Docs(index string) []Doc {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var docs []Doc
+	for _, d := range s.indices[index] {
+		docs = append(docs, Doc{ID: d.id, Source: d.source})
+	}
+	return docs
+}
+
+// SetMapping sets the properties returned by the _mapping API for index.
+func (s *Server) SetMapping(index string, properties map[string]interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.mappings[index] = properties
+}
+
+// Fail makes the next times requests to endpoint fail with fault.
+func (s *Server) Fail(endpoint string, times int, fault Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := 0; i < times; i++ {
+		s.faults[endpoint] = append(s.faults[endpoint], fault)
+	}
+}
+
+// Expire drops every open scroll and point in time, as if their keep-alive
+// had passed.
+func (s *Server) Expire() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.contexts = make(map[string]*cursor)
+}
+
+// OpenContexts returns the number of scrolls and points in time that have
+// not been cleared.
+func (s *Server) OpenContexts() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.contexts)
+}
+
+// Requests returns the number of requests received by endpoint, including
+// failed ones.
+func (s *Server) Requests(endpoint string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[endpoint]
+}
+
+// route maps a request to its endpoint and index.
+func route(r *http.Request) (endpoint, index string) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch {
+	case len(parts) >= 2 && parts[0] == "_search" && parts[1] == "scroll":
+		if r.Method == http.MethodDelete {
+			return ClearScroll, ""
+		}
+		return Scroll, ""
+	case len(parts) == 1 && parts[0] == "_search":
+		return Search, ""
+	case len(parts) == 1 && parts[0] == "_pit" && r.Method == http.MethodDelete:
+		return ClosePIT, ""
+	case len(parts) == 1 && parts[0] == "_bulk":
+		return Bulk, ""
+	case len(parts) == 2:
+		switch parts[1] {
+		case "_search":
+			return Search, parts[0]
+		case "_pit":
+			return OpenPIT, parts[0]
+		case "_count":
+			return Count, parts[0]
+		case "_bulk":
+			return Bulk, parts[0]
+		case "_mapping":
+			return Mapping, parts[0]
+		}
+	}
+	return "", ""
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("X-Elastic-Product", "Elasticsearch")
+	w.Header().Set("Content-Type", "application/json")
+
+	endpoint, index := route(r)
+	if endpoint == "" {
+		writeError(w, http.StatusBadRequest, "illegal_argument_exception",
+			fmt.Sprintf("no handler found for %s %s", r.Method, r.URL.Path))
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "illegal_argument_exception", err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	s.requests[endpoint]++
+	var fault Fault
+	if queue := s.faults[endpoint]; len(queue) > 0 {
+		fault, s.faults[endpoint] = queue[0], queue[1:]
+	}
+	s.mu.Unlock()
+
+	if fault.Delay > 0 {
+		select {
+		case <-time.After(fault.Delay):
+		case <-r.Context().Done():
+			return
+		}
+	}
+	if fault.Status != 0 {
+		if fault.RetryAfter != "" {
+			w.Header().Set("Retry-After", fault.RetryAfter)
+		}
+		writeError(w, fault.Status, fault.Type, "injected fault")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	status, response := s.handle(endpoint, index, r, body, fault)
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
+
+// handle serves a request with s.mu held.
+func (s *Server) handle(endpoint, index string, r *http.Request, body []byte, fault Fault) (int, interface{}) {
+	switch endpoint {
+	case Search:
+		return s.search(index, r, body, fault)
+	case Scroll:
+		return s.scroll(r, body, fault)
+	case ClearScroll:
+		return s.clearScroll(r, body)
+	case OpenPIT:
+		return s.openPIT(index)
+	case ClosePIT:
+		return s.closePIT(body)
+	case Count:
+		return s.count(index, body)
+	case Bulk:
+		return s.bulk(index, body)
+	default:
+		return s.mapping(index)
+	}
+}
+
+// searchBody is the part of a search request the server understands.
+type searchBody struct {
+	Query       json.RawMessage `json:"query"`
+	Sort        json.RawMessage `json:"sort"`
+	Size        *int            `json:"size"`
+	SearchAfter []interface{}   `json:"search_after"`
+	Slice       *struct {
+		ID  int `json:"id"`
+		Max int `json:"max"`
+	} `json:"slice"`
+	PIT *struct {
+		ID string `json:"id"`
+	} `json:"pit"`
+	SeqNoPrimaryTerm bool `json:"seq_no_primary_term"`
+}
+
+func (s *Server) search(index string, r *http.Request, body []byte, fault Fault) (int, interface{}) {
+	var req searchBody
+	if len(body) > 0 {
+		dec := json.NewDecoder(bytes.NewReader(body))
+		dec.UseNumber()
+		if err := dec.Decode(&req); err != nil {
+			return errorBody(http.StatusBadRequest, "parsing_exception", err.Error())
+		}
+	}
+	query, err := parseQuery(req.Query)
+	if err != nil {
+		return errorBody(http.StatusBadRequest, "parsing_exception", err.Error())
+	}
+	sort, err := parseSort(req.Sort)
+	if err != nil {
+		return errorBody(http.StatusBadRequest, "parsing_exception", err.Error())
+	}
+	size := 10
+	if req.Size != nil {
+		size = *req.Size
+	} else if n, err := strconv.Atoi(r.URL.Query().Get("size")); err == nil {
+		size = n
+	}
+	seqNo := req.SeqNoPrimaryTerm || r.URL.Query().Get("seq_no_primary_term") == "true"
+
+	// The documents searched: those of a point in time, or of the index
+	var docs []*doc
+	var contextID string
+	if req.PIT != nil {
+		if index != "" {
+			return errorBody(http.StatusBadRequest, "action_request_validation_exception",
+				"[indices] cannot be used with point in time")
+		}
+		pit, ok := s.contexts[req.PIT.ID]
+		if !ok {
+			return errorBody(http.StatusNotFound, "search_context_missing_exception",
+				"No search context found for id ["+req.PIT.ID+"]")
+		}
+		docs = pit.docs
+		contextID = req.PIT.ID
+	} else {
+		if index == "" {
+			index = "*"
+		}
+		docs = s.matchIndex(index)
+	}
+
+	var hits []*doc
+	for _, d := range docs {
+		if req.Slice != nil && req.Slice.Max > 0 && int(d.seq%int64(req.Slice.Max)) != req.Slice.ID {
+			continue
+		}
+		if query.match(d) {
+			hits = append(hits, d)
+		}
+	}
+	sortDocs(hits, sort)
+	total := len(hits)
+	if req.SearchAfter != nil {
+		hits = after(hits, sort, req.SearchAfter)
+	}
+
+	if scroll := r.URL.Query().Get("scroll"); scroll != "" && req.PIT == nil {
+		s.nextID++
+		contextID = fmt.Sprintf("scroll-%d", s.nextID)
+		s.contexts[contextID] = &cursor{docs: hits, sort: sort, size: size, seqNo: seqNo}
+		return http.StatusOK, s.page(contextID, "_scroll_id", hits, 0, size, total, sort, seqNo, fault)
+	}
+	if req.PIT != nil {
+		return http.StatusOK, s.page(contextID, "pit_id", hits, 0, size, total, sort, seqNo, fault)
+	}
+	return http.StatusOK, s.page("", "", hits, 0, size, total, sort, seqNo, fault)
+}
+
+func (s *Server) scroll(r *http.Request, body []byte, fault Fault) (int, interface{}) {
+	id := scrollID(r, body)
+	c, ok := s.contexts[id]
+	if !ok {
+		return errorBody(http.StatusNotFound, "search_context_missing_exception",
+			"No search context found for id ["+id+"]")
+	}
+	c.offset += c.size
+	return http.StatusOK, s.page(id, "_scroll_id", c.docs, c.offset, c.size, len(c.docs), c.sort, c.seqNo, fault)
+}
+
+// scrollID reads the scroll ID from the path, query string or body.
+func scrollID(r *http.Request, body []byte) string {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) == 3 {
+		return parts[2]
+	}
+	if id := r.URL.Query().Get("scroll_id"); id != "" {
+		return id
+	}
+	var req struct {
+		ScrollID interface{} `json:"scroll_id"`
+	}
+	json.Unmarshal(body, &req)
+	switch id := req.ScrollID.(type) {
+	case string:
+		return id
+	case []interface{}:
+		if len(id) > 0 {
+			s, _ := id[0].(string)
+			return s
+		}
+	}
+	return ""
+}
+
+func (s *Server) clearScroll(r *http.Request, body []byte) (int, interface{}) {
+	id := scrollID(r, body)
+	if _, ok := s.contexts[id]; !ok {
+		return http.StatusNotFound, map[string]interface{}{"succeeded": true, "num_freed": 0}
+	}
+	delete(s.contexts, id)
+	return http.StatusOK, map[string]interface{}{"succeeded": true, "num_freed": 1}
+}
+
+func (s *Server) openPIT(index string) (int, interface{}) {
+	docs := s.matchIndex(index)
+	s.nextID++
+	id := fmt.Sprintf("pit-%d", s.nextID)
+	s.contexts[id] = &cursor{docs: append([]*doc(nil), docs...)}
+	return http.StatusOK, map[string]interface{}{"id": id}
+}
+
+func (s *Server) closePIT(body []byte) (int, interface{}) {
+	var req struct {
+		ID string `json:"id"`
+	}
+	json.Unmarshal(body, &req)
+	if _, ok := s.contexts[req.ID]; !ok {
+		return http.StatusNotFound, map[string]interface{}{"succeeded": true, "num_freed": 0}
+	}
+	delete(s.contexts, req.ID)
+	return http.StatusOK, map[string]interface{}{"succeeded": true, "num_freed": 1}
+}
+
+func (s *Server) count(index string, body []byte) (int, interface{}) {
+	var req searchBody
+	if len(body) > 0 {
+		if err := json.Unmarshal(body, &req); err != nil {
+			return errorBody(http.StatusBadRequest, "parsing_exception", err.Error())
+		}
+	}
+	query, err := parseQuery(req.Query)
+	if err != nil {
+		return errorBody(http.StatusBadRequest, "parsing_exception", err.Error())
+	}
+	n := 0
+	for _, d := range s.matchIndex(index) {
+		if query.match(d) {
+			n++
+		}
+	}
+	return http.StatusOK, map[string]interface{}{"count": n}
+}
+
+// bulk applies index and create actions. Other actions fail per item.
+func (s *Server) bulk(defaultIndex string, body []byte) (int, interface{}) {
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(make([]byte, 64*1024), len(body)+1)
+	var items []interface{}
+	hasErrors := false
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var action map[string]struct {
+			Index string `json:"_index"`
+			ID    string `json:"_id"`
+		}
+		if err := json.Unmarshal(line, &action); err != nil || len(action) != 1 {
+			return errorBody(http.StatusBadRequest, "illegal_argument_exception", "malformed action/metadata line")
+		}
+		for name, meta := range action {
+			index := meta.Index
+			if index == "" {
+				index = defaultIndex
+			}
+			if name != "index" && name != "create" {
+				hasErrors = true
+				items = append(items, map[string]interface{}{name: map[string]interface{}{
+					"_index": index, "_id": meta.ID, "status": http.StatusBadRequest,
+					"error": map[string]interface{}{"type": "illegal_argument_exception", "reason": "unsupported action " + name},
+				}})
+				continue
+			}
+			if !scanner.Scan() {
+				return errorBody(http.StatusBadRequest, "illegal_argument_exception", "missing source for action")
+			}
+			var source map[string]interface{}
+			dec := json.NewDecoder(bytes.NewReader(scanner.Bytes()))
+			dec.UseNumber()
+			if err := dec.Decode(&source); err != nil {
+				hasErrors = true
+				items = append(items, map[string]interface{}{name: map[string]interface{}{
+					"_index": index, "_id": meta.ID, "status": http.StatusBadRequest,
+					"error": map[string]interface{}{"type": "document_parsing_exception", "reason": err.Error()},
+				}})
+				continue
+			}
+			id := meta.ID
+			if id == "" {
+				s.nextID++
+				id = fmt.Sprintf("auto-%d", s.nextID)
+			}
+			s.put(index, id, source)
+			items = append(items, map[string]interface{}{name: map[string]interface{}{
+				"_index": index, "_id": id, "status": http.StatusCreated, "result": "created",
+			}})
+		}
+	}
+	return http.StatusOK, map[string]interface{}{"took": 1, "errors": hasErrors, "items": items}
+}
+
+func (s *Server) mapping(index string) (int, interface{}) {
+	result := make(map[string]interface{})
+	for name := range s.indices {
+		if ok, _ := path.Match(index, name); ok || name == index {
+			properties := s.mappings[name]
+			if properties == nil {
+				properties = map[string]interface{}{}
+			}
+			result[name] = map[string]interface{}{"mappings": map[string]interface{}{"properties": properties}}
+		}
+	}
+	if len(result) == 0 {
+		return errorBody(http.StatusNotFound, "index_not_found_exception", "no such index ["+index+"]")
+	}
+	return http.StatusOK, result
+}
+
+// matchIndex returns the documents of every index matching the
+// comma-separated list of names and patterns.
+func (s *Server) matchIndex(pattern string) []*doc {
+	var docs []*doc
+	for name, indexDocs := range s.indices {
+		for _, p := range strings.Split(pattern, ",") {
+			if ok, _ := path.Match(p, name); ok || p == "_all" {
+				docs = append(docs, indexDocs...)
+				break
+			}
+		}
+	}
+	sortDocs(docs, nil)
+	return docs
+}
+
+// page renders hits[offset:offset+size] as a search response.
+func (s *Server) page(id, idKey string, hits []*doc, offset, size, total int, sort []sortField, seqNo bool, fault Fault) map[string]interface{} {
+	if offset > len(hits) {
+		offset = len(hits)
+	}
+	end := offset + size
+	if end > len(hits) {
+		end = len(hits)
+	}
+
+	rendered := make([]interface{}, 0, end-offset)
+	for _, d := range hits[offset:end] {
+		hit := map[string]interface{}{"_index": d.index, "_id": d.id, "_source": d.source}
+		if sort != nil {
+			hit["_score"] = nil
+			hit["sort"] = sortValues(d, sort)
+		} else {
+			hit["_score"] = 1.0
+		}
+		if seqNo {
+			hit["_seq_no"] = d.seq
+			hit["_primary_term"] = 1
+		}
+		rendered = append(rendered, hit)
+	}
+
+	response := map[string]interface{}{
+		"took":      1,
+		"timed_out": fault.TimedOut,
+		"_shards":   shards(fault.FailedShards),
+		"hits": map[string]interface{}{
+			"total": map[string]interface{}{"value": total, "relation": "eq"},
+			"hits":  rendered,
+		},
+	}
+	if idKey != "" {
+		response[idKey] = id
+	}
+	return response
+}
+
+func shards(failed int) map[string]interface{} {
+	total := failed + 1
+	result := map[string]interface{}{"total": total, "successful": total - failed, "skipped": 0, "failed": failed}
+	if failed > 0 {
+		var failures []interface{}
+		for i := 0; i < failed; i++ {
+			failures = append(failures, map[string]interface{}{
+				"shard": i + 1, "index": "estest", "node": "estest-node",
+				"reason": map[string]interface{}{"type": "injected_failure", "reason": "injected fault"},
+			})
+		}
+		result["failures"] = failures
+	}
+	return result
+}
+
+func errorBody(status int, errType, reason string) (int, interface{}) {
+	cause := map[string]interface{}{"type": errType, "reason": reason}
+	return status, map[string]interface{}{
+		"error": map[string]interface{}{
+			"root_cause": []interface{}{cause},
+			"type":       errType,
+			"reason":     reason,
+		},
+		"status": status,
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, errType, reason string) {
+	status, body := errorBody(status, errType, reason)
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,169 @@
+// estest/server_test.go
+package estest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/terenzio/ElasticSearchQuerier/client"
+)
+
+// newLogs returns a server holding n documents in the logs index.
+func newLogs(t *testing.T, n int) *Server {
+	s := New(t)
+	for i := 1; i <= n; i++ {
+		s.Index("logs", Doc{ID: fmt.Sprint(i), Source: map[string]interface{}{"n": i, "level": []string{"info", "warn"}[i%2]}})
+	}
+	return s
+}
+
+// fastRetries keeps retries from slowing the tests down.
+var fastRetries = client.RetryPolicy{InitialInterval: time.Millisecond, MaxInterval: time.Millisecond, MaxElapsedTime: time.Second}
+
+// export runs query through a sliced search and returns the IDs in order.
+func export(t *testing.T, s *Server, mode, query string, slices int) ([]string, error) {
+	newSearcher := func() (client.Searcher, error) {
+		searcher, err := client.NewSearcher(mode, s.Client(), time.Minute, 2, "logs")
+		if err != nil {
+			return nil, err
+		}
+		searcher.(client.Retrier).SetRetryPolicy(fastRetries)
+		return searcher, nil
+	}
+	var ids []string
+	err := client.SlicedSearch(context.Background(), newSearcher, query, slices, func(page *client.Page) error {
+		for _, hit := range page.Hits {
+			ids = append(ids, hit.ID)
+		}
+		return nil
+	})
+	return ids, err
+}
+
+func TestServerPaginates(t *testing.T) {
+	tests := []struct {
+		mode, query string
+		slices      int
+		expected    string
+	}{
+		{client.ModeScroll, `{"query":{"match_all":{}}}`, 1, "1 2 3 4 5"},
+		{client.ModePIT, `{"query":{"match_all":{}}}`, 1, "1 2 3 4 5"},
+		{client.ModePIT, `{"query":{"term":{"level":"info"}},"sort":[{"n":"desc"}]}`, 1, "4 2"},
+		{client.ModeScroll, `{"query":{"range":{"n":{"gte":2,"lt":5}}}}`, 1, "2 3 4"},
+		{client.ModePIT, `{"query":{"match_all":{}}}`, 2, "2 4 1 3 5"},
+	}
+	for _, test := range tests {
+		s := newLogs(t, 5)
+		ids, err := export(t, s, test.mode, test.query, test.slices)
+		if err != nil {
+			t.Fatalf("Error exporting %s: %s", test.query, err)
+		}
+		if strings.Join(ids, " ") != test.expected {
+			t.Errorf("Expected %q for %s with %d slices but got %q", test.expected, test.query, test.slices, strings.Join(ids, " "))
+		}
+		if n := s.OpenContexts(); n != 0 {
+			t.Errorf("Expected every search context to be cleared, %d left open", n)
+		}
+	}
+}
+
+func TestServerRejectsUnknownQueries(t *testing.T) {
+	s := newLogs(t, 1)
+	_, err := export(t, s, client.ModeScroll, `{"query":{"fuzzy":{"level":"inf"}}}`, 1)
+	var respErr *client.ResponseError
+	if !errors.As(err, &respErr) || respErr.StatusCode != 400 {
+		t.Errorf("Expected a 400 but got %v", err)
+	}
+}
+
+func TestServerFaults(t *testing.T) {
+	s := newLogs(t, 3)
+	s.Fail(Search, 2, Rejected)
+	ids, err := export(t, s, client.ModeScroll, `{}`, 1)
+	if err != nil || len(ids) != 3 {
+		t.Errorf("Expected the export to succeed after retries but got %v, %v", ids, err)
+	}
+	if n := s.Requests(Search); n != 3 {
+		t.Errorf("Expected 3 search requests but got %d", n)
+	}
+
+	s = newLogs(t, 3)
+	s.Fail(Scroll, 1, ShardFailure)
+	if _, err := export(t, s, client.ModeScroll, `{}`, 1); !errors.Is(err, client.ErrShardFailures) {
+		t.Errorf("Expected ErrShardFailures but got %v", err)
+	}
+
+	s = newLogs(t, 3)
+	s.Fail(Search, 1, Fault{Delay: time.Second})
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = client.NewESClient(s.Client(), time.Minute, 2, "logs").InitialSearch(ctx, `{}`)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the slow search to time out but got %v", err)
+	}
+}
+
+func TestServerExpiredContexts(t *testing.T) {
+	s := newLogs(t, 5)
+	searcher := client.NewPITClient(s.Client(), time.Minute, 2, "logs")
+	ctx := context.Background()
+
+	first, err := searcher.InitialSearch(ctx, `{"sort":[{"n":"asc"}]}`)
+	if err != nil {
+		t.Fatalf("Error running initial search: %s", err)
+	}
+	s.Expire()
+	second, err := searcher.Scroll(ctx, first.ScrollID)
+	if err != nil {
+		t.Fatalf("Error scrolling after expiry: %s", err)
+	}
+	if !second.Recovered || len(second.Hits) != 2 || second.Hits[0].ID != "3" {
+		t.Errorf("Expected documents 3 and 4 from a recovered search but got %+v", second)
+	}
+	searcher.ClearScroll(ctx, second.ScrollID)
+
+	s.Fail(Scroll, 1, ContextMissing)
+	scroller := client.NewESClient(s.Client(), time.Minute, 2, "logs")
+	first, err = scroller.InitialSearch(ctx, `{"sort":["_doc"]}`)
+	if err != nil {
+		t.Fatalf("Error running initial search: %s", err)
+	}
+	if _, err := scroller.Scroll(ctx, first.ScrollID); !errors.Is(err, client.ErrNotRecoverable) {
+		t.Errorf("Expected ErrNotRecoverable but got %v", err)
+	}
+}
+
+func TestServerCountAndBulk(t *testing.T) {
+	s := newLogs(t, 4)
+	ctx := context.Background()
+
+	count, err := client.Count(ctx, s.Client(), fastRetries, "logs", `{"query":{"bool":{"must_not":{"term":{"level":"warn"}}}}}`)
+	if err != nil {
+		t.Fatalf("Error counting: %s", err)
+	}
+	if count != 2 {
+		t.Errorf("Expected 2 documents but got %d", count)
+	}
+
+	input := `{"index":{"_index":"copy","_id":"a"}}
+{"title":"first"}
+{"delete":{"_index":"copy","_id":"b"}}
+{"create":{"_index":"copy","_id":"c"}}
+{"title":"second"}
+`
+	var report strings.Builder
+	stats, err := client.NewBulkImporter(s.Client(), "", 10).Import(ctx, strings.NewReader(input), &report)
+	if err != nil {
+		t.Fatalf("Error importing: %s", err)
+	}
+	if stats.Succeeded != 2 || stats.Failed != 1 {
+		t.Errorf("Expected 2 succeeded and 1 failed but got %+v", stats)
+	}
+	if docs := s.Docs("copy"); len(docs) != 2 || docs[1].Source["title"] != "second" {
+		t.Errorf("Expected 2 imported documents but got %+v", docs)
+	}
+}
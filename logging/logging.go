@@ -0,0 +1,108 @@
+// logging/logging.go
+
+// Package logging builds the log/slog loggers of the commands and the
+// redaction applied to everything they write.
+//
+// Records use the same field names throughout: index, slice, page,
+// total_pages, docs, malformed, scroll_id (a hash of the ID, see ScrollID),
+// duration and error.
+package logging
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+// Formats accepted by New.
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// New returns a logger writing records of level and above to w, as
+// logfmt-style text or as JSON objects, with secrets redacted from every
+// message and value; see Redact.
+func New(w io.Writer, format string, level slog.Level) (*slog.Logger, error) {
+	opts := &slog.HandlerOptions{Level: level, ReplaceAttr: redactAttr}
+	switch format {
+	case FormatText:
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	case FormatJSON:
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	}
+	return nil, fmt.Errorf("unknown log format %q", format)
+}
+
+// ParseLevel parses debug, info, warn or error.
+func ParseLevel(level string) (slog.Level, error) {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		return 0, fmt.Errorf("unknown log level %q", level)
+	}
+	return l, nil
+}
+
+// ScrollID returns the scroll_id field for a scroll or point-in-time ID.
+// The IDs run to hundreds of bytes and grant access to the search, so only
+// a short hash is logged, enough to tell them apart.
+func ScrollID(id string) slog.Attr {
+	if id == "" {
+		return slog.String("scroll_id", "")
+	}
+	sum := sha256.Sum256([]byte(id))
+	return slog.String("scroll_id", hex.EncodeToString(sum[:6]))
+}
+
+// secretKeys are field names whose values are never logged.
+var secretKeys = map[string]bool{
+	"password":      true,
+	"api_key":       true,
+	"apikey":        true,
+	"token":         true,
+	"service_token": true,
+	"authorization": true,
+}
+
+func redactAttr(groups []string, a slog.Attr) slog.Attr {
+	if secretKeys[strings.ToLower(a.Key)] {
+		return slog.String(a.Key, redacted)
+	}
+	switch a.Value.Kind() {
+	case slog.KindString:
+		return slog.String(a.Key, Redact(a.Value.String()))
+	case slog.KindAny:
+		switch v := a.Value.Any().(type) {
+		case error:
+			return slog.String(a.Key, Redact(v.Error()))
+		case fmt.Stringer:
+			return slog.String(a.Key, Redact(v.String()))
+		}
+	}
+	return a
+}
+
+const redacted = "[REDACTED]"
+
+var (
+	// scheme://user:password@ in URLs
+	urlPassword = regexp.MustCompile(`([a-zA-Z][a-zA-Z0-9+.-]*://[^/\s:@]+):[^@/\s]*@`)
+	// Authorization header values
+	authHeader = regexp.MustCompile(`(?i)\b(basic|bearer|apikey)\s+[A-Za-z0-9+/=._~-]{8,}`)
+	// Secrets in JSON bodies
+	jsonSecret = regexp.MustCompile(`(?i)("(?:password|api_key|token|secret)"\s*:\s*)"[^"]*"`)
+)
+
+// Redact masks the password of URLs, the credentials of Authorization
+// header values and the values of "password", "api_key", "token" and
+// "secret" JSON fields in s.
+func Redact(s string) string {
+	s = urlPassword.ReplaceAllString(s, "${1}:xxxxx@")
+	s = authHeader.ReplaceAllString(s, "${1} "+redacted)
+	s = jsonSecret.ReplaceAllString(s, `${1}"`+redacted+`"`)
+	return s
+}
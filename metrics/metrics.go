@@ -0,0 +1,141 @@
+// metrics/metrics.go
+
+// Package metrics holds the Prometheus collectors updated by the client and
+// processor packages, and serves them over HTTP. The collectors are always
+// updated; they are only exposed once Serve is called.
+package metrics
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "esquerier"
+
+var (
+	// DocumentsFetched counts the hits received from Elasticsearch,
+	// malformed ones included.
+	DocumentsFetched = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "documents_fetched_total",
+		Help:      "Hits received from Elasticsearch, malformed ones included.",
+	})
+	// DocumentsWritten counts the hits accepted by the sink.
+	DocumentsWritten = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "documents_written_total",
+		Help:      "Hits accepted by the sink.",
+	})
+	// Pages counts the search pages received.
+	Pages = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "pages_total",
+		Help:      "Search pages received from Elasticsearch.",
+	})
+	// RequestDuration observes every request to Elasticsearch, retried and
+	// failed attempts included, until its response headers arrive.
+	RequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "request_duration_seconds",
+		Help:      "Time until Elasticsearch answered a request, by endpoint.",
+		Buckets:   []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60},
+	}, []string{"endpoint"})
+	// Retries counts the requests sent again after a retryable failure.
+	Retries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "retries_total",
+		Help:      "Requests to Elasticsearch retried after a retryable failure, by endpoint.",
+	}, []string{"endpoint"})
+	// BytesWritten counts the bytes sinks have written to their output.
+	BytesWritten = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "bytes_written_total",
+		Help:      "Bytes written to the sink output.",
+	})
+	// SinkDuration observes the writes and flushes of the sink.
+	SinkDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "sink_duration_seconds",
+		Help:      "Time spent in the sink, by operation.",
+		Buckets:   prometheus.ExponentialBuckets(.0001, 4, 10),
+	}, []string{"operation"})
+	// Errors counts failures by class; see the Class constants.
+	Errors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "errors_total",
+		Help:      "Errors by class, including those of requests that were retried.",
+	}, []string{"class"})
+)
+
+// Error classes, the values of the "class" label of Errors.
+const (
+	// ClassRejected is a request rejected under load: a 429, or a rejected
+	// execution or circuit breaker exception.
+	ClassRejected = "rejected"
+	// ClassUnavailable is any other retryable error response, such as a 503.
+	ClassUnavailable = "unavailable"
+	// ClassTimeout is a request that timed out before it was answered.
+	ClassTimeout = "timeout"
+	// ClassConnection is a request that got no response otherwise.
+	ClassConnection = "connection"
+	// ClassContextLost is an expired or missing scroll or point in time.
+	ClassContextLost = "context_lost"
+	// ClassResponse is an error response that is not retried, such as a
+	// malformed query or a missing index.
+	ClassResponse = "response"
+	// ClassShardFailure is a page with failed shards or a timed out search.
+	ClassShardFailure = "shard_failure"
+	// ClassMalformedHit is a hit that could not be parsed.
+	ClassMalformedHit = "malformed_hit"
+	// ClassMalformedResponse is a response that could not be parsed.
+	ClassMalformedResponse = "malformed_response"
+	// ClassSink is a failure to write, flush or close the sink.
+	ClassSink = "sink"
+)
+
+// Registry holds the collectors of this package and the Go runtime and
+// process collectors.
+var Registry = prometheus.NewRegistry()
+
+func init() {
+	Registry.MustRegister(
+		DocumentsFetched, DocumentsWritten, Pages, RequestDuration,
+		Retries, BytesWritten, SinkDuration, Errors,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// Handler serves the collectors of Registry in the Prometheus text format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+// Serve exposes Handler at /metrics on addr, such as ":9090", until the
+// returned server is closed. It returns once the listener is bound, with
+// the server's Addr set to the address bound.
+func Serve(addr string) (*http.Server, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen for metrics: %w", err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", Handler())
+	server := &http.Server{Addr: listener.Addr().String(), Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Warn("Metrics listener failed", "error", err)
+		}
+	}()
+	slog.Info("Serving metrics", "url", "http://"+server.Addr+"/metrics")
+	return server, nil
+}
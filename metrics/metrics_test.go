@@ -0,0 +1,39 @@
+// metrics/metrics_test.go
+package metrics
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestServe(t *testing.T) {
+	server, err := Serve("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Error serving metrics: %s", err)
+	}
+	defer server.Close()
+
+	Pages.Inc()
+	Errors.WithLabelValues(ClassRejected).Inc()
+	res, err := http.Get("http://" + server.Addr + "/metrics")
+	if err != nil {
+		t.Fatalf("Error scraping metrics: %s", err)
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatalf("Error reading metrics: %s", err)
+	}
+
+	for _, expected := range []string{
+		"esquerier_pages_total 1",
+		`esquerier_errors_total{class="rejected"} 1`,
+		"go_goroutines",
+	} {
+		if !strings.Contains(string(body), expected) {
+			t.Errorf("Expected %q in the metrics but got:\n%s", expected, body)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+// processor/bulk.go
+package processor
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/terenzio/ElasticSearchQuerier/client"
+)
+
+func init() {
+	Register("bulk", func(opts Options) (Sink, error) {
+		return NewBulkProcessor(opts.Path), nil
+	})
+}
+
+// BulkProcessor writes hits in the Elasticsearch _bulk NDJSON format: an
+// "index" action line carrying _index, _id and routing, followed by the
+// _source line. The file can be loaded back with client.BulkImporter or
+// sent to the _bulk API as is.
+type BulkProcessor struct {
+	filepath string
+	file     *os.File
+	w        *bufio.Writer
+	enc      *json.Encoder
+}
+
+func NewBulkProcessor(filepath string) *BulkProcessor {
+	return &BulkProcessor{filepath: filepath}
+}
+
+type bulkAction struct {
+	Index bulkMeta `json:"index"`
+}
+
+type bulkMeta struct {
+	Index   string `json:"_index,omitempty"`
+	ID      string `json:"_id,omitempty"`
+	Routing string `json:"routing,omitempty"`
+}
+
+func (p *BulkProcessor) Open() error {
+	file, err := openOutput(p.filepath)
+	if err != nil {
+		return err
+	}
+	p.file = file
+	p.w = newOutputWriter(file)
+	p.enc = json.NewEncoder(p.w)
+	p.enc.SetEscapeHTML(false)
+	return nil
+}
+
+func (p *BulkProcessor) Resume(offset int64) error {
+	file, err := resumeOutput(p.filepath, offset)
+	if err != nil {
+		return err
+	}
+	p.file = file
+	p.w = newOutputWriter(file)
+	p.enc = json.NewEncoder(p.w)
+	p.enc.SetEscapeHTML(false)
+	return nil
+}
+
+func (p *BulkProcessor) Write(hits []client.Hit) error {
+	for _, hit := range hits {
+		if hit.Source == nil {
+			return fmt.Errorf("document %s has no _source to export", hit.ID)
+		}
+		action := bulkAction{Index: bulkMeta{Index: hit.Index, ID: hit.ID, Routing: hit.Routing}}
+		if err := p.enc.Encode(action); err != nil {
+			return fmt.Errorf("failed to write action for document %s: %w", hit.ID, err)
+		}
+		if err := p.enc.Encode(hit.Source); err != nil {
+			return fmt.Errorf("failed to write document %s: %w", hit.ID, err)
+		}
+	}
+	return nil
+}
+
+func (p *BulkProcessor) Flush() error {
+	if err := p.w.Flush(); err != nil {
+		return fmt.Errorf("failed to flush file: %w", err)
+	}
+	return nil
+}
+
+func (p *BulkProcessor) Offset() (int64, error) {
+	if err := p.Flush(); err != nil {
+		return 0, err
+	}
+	return outputOffset(p.file)
+}
+
+func (p *BulkProcessor) Close() error {
+	if err := p.Flush(); err != nil {
+		return err
+	}
+	return closeOutput(p.file)
+}
@@ -0,0 +1,77 @@
+package processor
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/terenzio/ElasticSearchQuerier/client"
+	"github.com/terenzio/ElasticSearchQuerier/estest"
+)
+
+func TestBulkProcessorRoundTrip(t *testing.T) {
+	hits := []client.Hit{
+		{ID: "1", Index: "logs-a", Source: map[string]interface{}{"title": "Document 1"}},
+		{ID: "2", Index: "logs-b", Routing: "user-7", Source: map[string]interface{}{"title": "Document <2>"}},
+	}
+
+	path := filepath.Join(t.TempDir(), "export.ndjson")
+	sink, err := New("bulk", Options{Path: path})
+	if err != nil {
+		t.Fatalf("Error creating sink: %s", err)
+	}
+	if err := sink.Open(); err != nil {
+		t.Fatalf("Error opening sink: %s", err)
+	}
+	if err := sink.Write(hits); err != nil {
+		t.Fatalf("Error writing hits: %s", err)
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatalf("Error closing sink: %s", err)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Error reading export: %s", err)
+	}
+	expected := strings.Join([]string{
+		`{"index":{"_index":"logs-a","_id":"1"}}`,
+		`{"title":"Document 1"}`,
+		`{"index":{"_index":"logs-b","_id":"2","routing":"user-7"}}`,
+		`{"title":"Document <2>"}`,
+		"",
+	}, "\n")
+	if string(content) != expected {
+		t.Errorf("Expected %q but got %q", expected, string(content))
+	}
+
+	// Without an index override every document returns to its own index
+	es := estest.New(t)
+	var report bytes.Buffer
+	stats, err := client.NewBulkImporter(es.Client(), "", 10).Import(context.Background(), bytes.NewReader(content), &report)
+	if err != nil {
+		t.Fatalf("Error importing: %s", err)
+	}
+	if stats.Succeeded != 2 || stats.Failed != 0 || report.Len() != 0 {
+		t.Errorf("Expected 2 documents imported but got %+v and report %q", stats, report.String())
+	}
+	for _, hit := range hits {
+		docs := es.Docs(hit.Index)
+		if len(docs) != 1 || docs[0].ID != hit.ID || fmt.Sprint(docs[0].Source) != fmt.Sprint(hit.Source) {
+			t.Errorf("Expected document %s in %s but got %+v", hit.ID, hit.Index, docs)
+		}
+	}
+
+	// With an override they all go to that index
+	stats, err = client.NewBulkImporter(es.Client(), "restored", 10).Import(context.Background(), bytes.NewReader(content), &report)
+	if err != nil {
+		t.Fatalf("Error importing: %s", err)
+	}
+	if docs := es.Docs("restored"); stats.Succeeded != 2 || len(docs) != 2 {
+		t.Errorf("Expected 2 documents in restored but got %+v", docs)
+	}
+}
@@ -0,0 +1,272 @@
+// processor/csv.go
+package processor
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/terenzio/ElasticSearchQuerier/client"
+)
+
+// Array modes select how a column holding several values is rendered.
+const (
+	// ArrayJoin joins the values with the configured separator.
+	ArrayJoin = "join"
+	// ArrayJSON renders the values as a JSON array.
+	ArrayJSON = "json"
+	// ArrayFirst keeps only the first value.
+	ArrayFirst = "first"
+)
+
+func init() {
+	Register("csv", func(opts Options) (Sink, error) {
+		return NewCSVProcessor(opts.Path, ',', opts)
+	})
+	Register("tsv", func(opts Options) (Sink, error) {
+		return NewCSVProcessor(opts.Path, '\t', opts)
+	})
+}
+
+// CSVProcessor writes one row per hit with a header row first. Columns are
+// dotted paths into _source such as "user.address.city"; "_id", "_index" and
+// "_routing" select hit metadata. Arrays met along a path are walked, so
+// "orders.sku" on a document with several orders yields all of their SKUs.
+// Paths that resolve to nothing produce an empty cell.
+//
+// If no columns are configured they are taken from the leaf fields of the
+// first document written, in sorted order.
+type CSVProcessor struct {
+	filepath       string
+	comma          rune
+	columns        []string
+	arrayMode      string
+	arraySeparator string
+	file           *os.File
+	w              *bufio.Writer
+	csv            *csv.Writer
+	wroteHeader    bool
+}
+
+func NewCSVProcessor(filepath string, comma rune, opts Options) (*CSVProcessor, error) {
+	p := &CSVProcessor{
+		filepath:       filepath,
+		comma:          comma,
+		columns:        opts.Columns,
+		arrayMode:      opts.ArrayMode,
+		arraySeparator: opts.ArraySeparator,
+	}
+	if p.arrayMode == "" {
+		p.arrayMode = ArrayJoin
+	}
+	if p.arraySeparator == "" {
+		p.arraySeparator = "|"
+	}
+	switch p.arrayMode {
+	case ArrayJoin, ArrayJSON, ArrayFirst:
+	default:
+		return nil, fmt.Errorf("unknown array mode %q", p.arrayMode)
+	}
+	return p, nil
+}
+
+func (p *CSVProcessor) Open() error {
+	file, err := openOutput(p.filepath)
+	if err != nil {
+		return err
+	}
+	p.file = file
+	p.w = newOutputWriter(file)
+	p.csv = csv.NewWriter(p.w)
+	p.csv.Comma = p.comma
+	return nil
+}
+
+// Resume continues a CSV file. The header is not written again; without
+// configured columns they are read back from it.
+func (p *CSVProcessor) Resume(offset int64) error {
+	file, err := resumeOutput(p.filepath, offset)
+	if err != nil {
+		return err
+	}
+	if offset > 0 {
+		if len(p.columns) == 0 {
+			header := csv.NewReader(io.NewSectionReader(file, 0, offset))
+			header.Comma = p.comma
+			if p.columns, err = header.Read(); err != nil {
+				file.Close()
+				return fmt.Errorf("failed to read header of %s: %w", p.filepath, err)
+			}
+		}
+		p.wroteHeader = true
+	}
+	p.file = file
+	p.w = newOutputWriter(file)
+	p.csv = csv.NewWriter(p.w)
+	p.csv.Comma = p.comma
+	return nil
+}
+
+func (p *CSVProcessor) Write(hits []client.Hit) error {
+	if len(hits) == 0 {
+		return nil
+	}
+	if !p.wroteHeader {
+		if len(p.columns) == 0 {
+			p.columns = leafPaths(hits[0].Source)
+		}
+		if err := p.csv.Write(p.columns); err != nil {
+			return fmt.Errorf("failed to write header: %w", err)
+		}
+		p.wroteHeader = true
+	}
+
+	row := make([]string, len(p.columns))
+	for _, hit := range hits {
+		for i, column := range p.columns {
+			row[i] = p.cell(lookupColumn(hit, column))
+		}
+		if err := p.csv.Write(row); err != nil {
+			return fmt.Errorf("failed to write row for document %s: %w", hit.ID, err)
+		}
+	}
+	return nil
+}
+
+func (p *CSVProcessor) Flush() error {
+	p.csv.Flush()
+	if err := p.csv.Error(); err != nil {
+		return fmt.Errorf("failed to flush file: %w", err)
+	}
+	if err := p.w.Flush(); err != nil {
+		return fmt.Errorf("failed to flush file: %w", err)
+	}
+	return nil
+}
+
+func (p *CSVProcessor) Offset() (int64, error) {
+	if err := p.Flush(); err != nil {
+		return 0, err
+	}
+	return outputOffset(p.file)
+}
+
+func (p *CSVProcessor) Close() error {
+	if err := p.Flush(); err != nil {
+		return err
+	}
+	return closeOutput(p.file)
+}
+
+// cell renders the values found for a column.
+func (p *CSVProcessor) cell(values []interface{}) string {
+	switch {
+	case len(values) == 0:
+		return ""
+	case len(values) == 1 || p.arrayMode == ArrayFirst:
+		return formatValue(values[0])
+	case p.arrayMode == ArrayJSON:
+		b, err := json.Marshal(values)
+		if err != nil {
+			return fmt.Sprint(values)
+		}
+		return string(b)
+	default:
+		parts := make([]string, len(values))
+		for i, v := range values {
+			parts[i] = formatValue(v)
+		}
+		return strings.Join(parts, p.arraySeparator)
+	}
+}
+
+func lookupColumn(hit client.Hit, column string) []interface{} {
+	switch column {
+	case "_id":
+		return []interface{}{hit.ID}
+	case "_index":
+		return []interface{}{hit.Index}
+	case "_routing":
+		if hit.Routing == "" {
+			return nil
+		}
+		return []interface{}{hit.Routing}
+	}
+	return lookupPath(hit.Source, strings.Split(column, "."))
+}
+
+// lookupPath collects the values at path below v, descending into every
+// element of any array on the way.
+func lookupPath(v interface{}, path []string) []interface{} {
+	switch v := v.(type) {
+	case nil:
+		return nil
+	case []interface{}:
+		var values []interface{}
+		for _, elem := range v {
+			values = append(values, lookupPath(elem, path)...)
+		}
+		return values
+	case map[string]interface{}:
+		if len(path) == 0 {
+			return []interface{}{v}
+		}
+		// A dotted field name stored literally takes precedence over nesting.
+		for i := len(path); i > 0; i-- {
+			if child, ok := v[strings.Join(path[:i], ".")]; ok {
+				return lookupPath(child, path[i:])
+			}
+		}
+		return nil
+	default:
+		if len(path) == 0 {
+			return []interface{}{v}
+		}
+		return nil
+	}
+}
+
+// leafPaths lists the dotted paths of every non-object value in doc.
+func leafPaths(doc map[string]interface{}) []string {
+	var paths []string
+	var walk func(prefix string, v interface{})
+	walk = func(prefix string, v interface{}) {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			paths = append(paths, prefix)
+			return
+		}
+		for k, child := range m {
+			walk(prefix+"."+k, child)
+		}
+	}
+	for k, v := range doc {
+		walk(k, v)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func formatValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case map[string]interface{}, []interface{}:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprint(v)
+		}
+		return string(b)
+	default:
+		return fmt.Sprint(v)
+	}
+}
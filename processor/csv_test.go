@@ -0,0 +1,124 @@
+package processor
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/terenzio/ElasticSearchQuerier/client"
+)
+
+func TestCSVProcessorFlattensColumns(t *testing.T) {
+	var source map[string]interface{}
+	doc := `{
+		"user": {"name": "Ann", "address": {"city": "Taipei"}},
+		"orders": [{"sku": "A1", "qty": 2}, {"sku": "B2"}],
+		"tags": ["x", "y"]
+	}`
+	if err := json.Unmarshal([]byte(doc), &source); err != nil {
+		t.Fatalf("Error parsing document: %s", err)
+	}
+	hits := []client.Hit{
+		{ID: "1", Source: source},
+		{ID: "2", Source: map[string]interface{}{"user": map[string]interface{}{"name": "Bo, Jr."}}},
+	}
+
+	tmpFile, err := os.CreateTemp("", "test_export_*.csv")
+	if err != nil {
+		t.Fatalf("Error creating temporary file: %s", err)
+	}
+	tmpFile.Close()
+	defer os.Remove(tmpFile.Name())
+
+	sink, err := New("csv", Options{
+		Path:    tmpFile.Name(),
+		Columns: []string{"_id", "user.name", "user.address.city", "orders.sku", "tags", "missing"},
+	})
+	if err != nil {
+		t.Fatalf("Error creating sink: %s", err)
+	}
+	if err := sink.Open(); err != nil {
+		t.Fatalf("Error opening sink: %s", err)
+	}
+	if err := sink.Write(hits); err != nil {
+		t.Fatalf("Error writing hits: %s", err)
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatalf("Error closing sink: %s", err)
+	}
+
+	content, err := os.ReadFile(tmpFile.Name())
+	if err != nil {
+		t.Fatalf("Error reading temporary file: %s", err)
+	}
+
+	expected := strings.Join([]string{
+		"_id,user.name,user.address.city,orders.sku,tags,missing",
+		"1,Ann,Taipei,A1|B2,x|y,",
+		`2,"Bo, Jr.",,,,`,
+		"",
+	}, "\n")
+	if string(content) != expected {
+		t.Errorf("Expected %q but got %q", expected, string(content))
+	}
+}
+
+func TestCSVProcessorResume(t *testing.T) {
+	tmpFile, err := os.CreateTemp("", "test_export_*.csv")
+	if err != nil {
+		t.Fatalf("Error creating temporary file: %s", err)
+	}
+	tmpFile.Close()
+	defer os.Remove(tmpFile.Name())
+
+	hit := func(id string) []client.Hit {
+		return []client.Hit{{ID: id, Source: map[string]interface{}{"id": id, "title": "Document " + id}}}
+	}
+
+	// Write one page, checkpoint, then a page the checkpoint never saw.
+	first, err := NewCSVProcessor(tmpFile.Name(), ',', Options{})
+	if err != nil {
+		t.Fatalf("Error creating sink: %s", err)
+	}
+	if err := first.Open(); err != nil {
+		t.Fatalf("Error opening sink: %s", err)
+	}
+	if err := first.Write(hit("1")); err != nil {
+		t.Fatalf("Error writing hits: %s", err)
+	}
+	offset, err := first.Offset()
+	if err != nil {
+		t.Fatalf("Error getting offset: %s", err)
+	}
+	if err := first.Write(hit("lost")); err != nil {
+		t.Fatalf("Error writing hits: %s", err)
+	}
+	if err := first.Close(); err != nil {
+		t.Fatalf("Error closing sink: %s", err)
+	}
+
+	// The resumed sink has no columns configured and must reuse the header.
+	resumed, err := NewCSVProcessor(tmpFile.Name(), ',', Options{})
+	if err != nil {
+		t.Fatalf("Error creating sink: %s", err)
+	}
+	if err := resumed.Resume(offset); err != nil {
+		t.Fatalf("Error resuming sink: %s", err)
+	}
+	if err := resumed.Write(hit("2")); err != nil {
+		t.Fatalf("Error writing hits: %s", err)
+	}
+	if err := resumed.Close(); err != nil {
+		t.Fatalf("Error closing sink: %s", err)
+	}
+
+	content, err := os.ReadFile(tmpFile.Name())
+	if err != nil {
+		t.Fatalf("Error reading temporary file: %s", err)
+	}
+	expected := "id,title\n1,Document 1\n2,Document 2\n"
+	if string(content) != expected {
+		t.Errorf("Expected %q but got %q", expected, string(content))
+	}
+}
@@ -0,0 +1,104 @@
+// processor/deadletter.go
+package processor
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/terenzio/ElasticSearchQuerier/client"
+)
+
+// DeadLetter records hits that could not be parsed, so an export can skip
+// them instead of aborting. Each one is written as a JSON line holding the
+// slice, page, error and raw hit. The file is only created once there is
+// something to write; with an empty path the hits are logged instead, at
+// warning level and without their content.
+type DeadLetter struct {
+	filepath string
+	append   bool
+	file     *os.File
+	w        *bufio.Writer
+	enc      *json.Encoder
+	count    int
+	log      *slog.Logger
+}
+
+// NewDeadLetter returns a dead-letter file at filepath, which replaces any
+// existing file unless append is set.
+func NewDeadLetter(filepath string, append bool) *DeadLetter {
+	return &DeadLetter{filepath: filepath, append: append}
+}
+
+// SetLogger sets where hits are logged when there is no file. It defaults to
+// slog.Default().
+func (d *DeadLetter) SetLogger(logger *slog.Logger) {
+	d.log = logger
+}
+
+type deadLetterEntry struct {
+	Slice int             `json:"slice"`
+	Page  int             `json:"page"`
+	Error string          `json:"error"`
+	Hit   json.RawMessage `json:"hit"`
+}
+
+// Write records the malformed hits of a page.
+func (d *DeadLetter) Write(slice, page int, hits []client.MalformedHit) error {
+	for _, hit := range hits {
+		d.count++
+		if d.filepath == "" {
+			logger := d.log
+			if logger == nil {
+				logger = slog.Default()
+			}
+			logger.Warn("Skipping malformed hit", "slice", slice, "page", page, "error", hit.Err)
+			continue
+		}
+		if d.file == nil {
+			if err := d.open(); err != nil {
+				return err
+			}
+		}
+		entry := deadLetterEntry{Slice: slice, Page: page, Error: hit.Err.Error(), Hit: hit.Raw}
+		if err := d.enc.Encode(entry); err != nil {
+			return fmt.Errorf("failed to write dead letter: %w", err)
+		}
+	}
+	return nil
+}
+
+func (d *DeadLetter) open() error {
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if d.append {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	}
+	file, err := os.OpenFile(d.filepath, flags, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to create dead-letter file: %w", err)
+	}
+	d.file = file
+	d.w = bufio.NewWriter(file)
+	d.enc = json.NewEncoder(d.w)
+	d.enc.SetEscapeHTML(false)
+	return nil
+}
+
+// Count returns the number of hits written so far.
+func (d *DeadLetter) Count() int {
+	return d.count
+}
+
+// Close flushes and closes the file, if it was created.
+func (d *DeadLetter) Close() error {
+	if d.file == nil {
+		return nil
+	}
+	if err := d.w.Flush(); err != nil {
+		d.file.Close()
+		return fmt.Errorf("failed to flush dead-letter file: %w", err)
+	}
+	return d.file.Close()
+}
@@ -0,0 +1,156 @@
+// processor/instrument.go
+package processor
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/terenzio/ElasticSearchQuerier/client"
+	"github.com/terenzio/ElasticSearchQuerier/metrics"
+)
+
+var tracer = otel.Tracer("github.com/terenzio/ElasticSearchQuerier/processor")
+
+// newOutputWriter buffers writes to the output of a sink, counting the bytes
+// that reach it.
+func newOutputWriter(w io.Writer) *bufio.Writer {
+	return bufio.NewWriter(countingWriter{w})
+}
+
+type countingWriter struct {
+	w io.Writer
+}
+
+func (c countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	metrics.BytesWritten.Add(float64(n))
+	return n, err
+}
+
+// Instrument wraps sink so that the documents it accepts, the time spent in
+// it and its failures are recorded in the metrics package, and its
+// operations other than Write are traced and logged at debug level; see
+// SetTraceContext and SetLogger. The result is a Resumable if sink is one.
+func Instrument(sink Sink) Sink {
+	switch s := sink.(type) {
+	case *instrumentedSink, *instrumentedResumable:
+		return sink
+	case Resumable:
+		return &instrumentedResumable{instrumentedSink{sink: s, ctx: context.Background()}, s}
+	}
+	return &instrumentedSink{sink: sink, ctx: context.Background()}
+}
+
+// SetTraceContext makes the spans of the operations of sink, if it was
+// returned by Instrument, children of the span of ctx. Sinks take no
+// context of their own, so this is how their flushes join the trace of the
+// export writing to them.
+func SetTraceContext(sink Sink, ctx context.Context) {
+	switch s := sink.(type) {
+	case *instrumentedSink:
+		s.ctx = ctx
+	case *instrumentedResumable:
+		s.ctx = ctx
+	}
+}
+
+// SetLogger makes sink, if it was returned by Instrument, log its operations
+// to logger instead of slog.Default().
+func SetLogger(sink Sink, logger *slog.Logger) {
+	switch s := sink.(type) {
+	case *instrumentedSink:
+		s.log = logger
+	case *instrumentedResumable:
+		s.log = logger
+	}
+}
+
+type instrumentedSink struct {
+	sink Sink
+	ctx  context.Context
+	log  *slog.Logger
+}
+
+func (s *instrumentedSink) Open() error {
+	end := s.observe("open")
+	return end(s.sink.Open())
+}
+
+// Write is not traced, as streaming exports write one hit at a time.
+func (s *instrumentedSink) Write(hits []client.Hit) error {
+	start := time.Now()
+	err := s.sink.Write(hits)
+	metrics.SinkDuration.WithLabelValues("write").Observe(time.Since(start).Seconds())
+	if err != nil {
+		metrics.Errors.WithLabelValues(metrics.ClassSink).Inc()
+		return err
+	}
+	metrics.DocumentsWritten.Add(float64(len(hits)))
+	return nil
+}
+
+func (s *instrumentedSink) Flush() error {
+	end := s.observe("flush")
+	return end(s.sink.Flush())
+}
+
+func (s *instrumentedSink) Close() error {
+	end := s.observe("close")
+	return end(s.sink.Close())
+}
+
+type instrumentedResumable struct {
+	instrumentedSink
+	resumable Resumable
+}
+
+func (s *instrumentedResumable) Offset() (int64, error) {
+	end := s.observe("offset")
+	offset, err := s.resumable.Offset()
+	return offset, end(err)
+}
+
+func (s *instrumentedResumable) Resume(offset int64) error {
+	end := s.observe("resume")
+	return end(s.resumable.Resume(offset))
+}
+
+// observe starts timing and tracing operation, and returns the function
+// recording its outcome, which returns the error it is given.
+func (s *instrumentedSink) observe(operation string) func(error) error {
+	start := time.Now()
+	sinkType := fmt.Sprintf("%T", s.sink)
+	_, span := tracer.Start(s.ctx, "Sink."+operation,
+		trace.WithAttributes(attribute.String("sink", sinkType)))
+	return func(err error) error {
+		duration := time.Since(start)
+		metrics.SinkDuration.WithLabelValues(operation).Observe(duration.Seconds())
+		logger := s.log
+		if logger == nil {
+			logger = slog.Default()
+		}
+		// The caller reports the error, so it is only logged here at debug
+		// level along with the timing.
+		args := []any{"sink", sinkType, "duration", duration}
+		if err != nil {
+			args = append(args, "error", err)
+		}
+		logger.Debug("Sink "+operation, args...)
+		if err != nil {
+			metrics.Errors.WithLabelValues(metrics.ClassSink).Inc()
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+		return err
+	}
+}
@@ -0,0 +1,90 @@
+// processor/jsonl.go
+package processor
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/terenzio/ElasticSearchQuerier/client"
+)
+
+func init() {
+	Register("jsonl", func(opts Options) (Sink, error) {
+		return NewJSONLProcessor(opts.Path, opts.Metadata), nil
+	})
+}
+
+// JSONLProcessor writes one JSON document per line. Without metadata each
+// line is the hit's _source; with metadata it is the whole hit, _source
+// nested under "_source" next to _id, _index, _routing, _seq_no and so on.
+type JSONLProcessor struct {
+	filepath string
+	metadata bool
+	file     *os.File
+	w        *bufio.Writer
+	enc      *json.Encoder
+}
+
+func NewJSONLProcessor(filepath string, metadata bool) *JSONLProcessor {
+	return &JSONLProcessor{filepath: filepath, metadata: metadata}
+}
+
+func (p *JSONLProcessor) Open() error {
+	file, err := openOutput(p.filepath)
+	if err != nil {
+		return err
+	}
+	p.file = file
+	p.w = newOutputWriter(file)
+	p.enc = json.NewEncoder(p.w)
+	p.enc.SetEscapeHTML(false)
+	return nil
+}
+
+func (p *JSONLProcessor) Resume(offset int64) error {
+	file, err := resumeOutput(p.filepath, offset)
+	if err != nil {
+		return err
+	}
+	p.file = file
+	p.w = newOutputWriter(file)
+	p.enc = json.NewEncoder(p.w)
+	p.enc.SetEscapeHTML(false)
+	return nil
+}
+
+func (p *JSONLProcessor) Write(hits []client.Hit) error {
+	for i := range hits {
+		var doc interface{} = hits[i].Source
+		if p.metadata {
+			doc = &hits[i]
+		}
+		if err := p.enc.Encode(doc); err != nil {
+			return fmt.Errorf("failed to write document %s: %w", hits[i].ID, err)
+		}
+	}
+	return nil
+}
+
+func (p *JSONLProcessor) Flush() error {
+	if err := p.w.Flush(); err != nil {
+		return fmt.Errorf("failed to flush file: %w", err)
+	}
+	return nil
+}
+
+func (p *JSONLProcessor) Offset() (int64, error) {
+	if err := p.Flush(); err != nil {
+		return 0, err
+	}
+	return outputOffset(p.file)
+}
+
+func (p *JSONLProcessor) Close() error {
+	if err := p.Flush(); err != nil {
+		return err
+	}
+	return closeOutput(p.file)
+}
@@ -0,0 +1,412 @@
+// processor/parquet.go
+package processor
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xitongsys/parquet-go/writer"
+
+	"github.com/terenzio/ElasticSearchQuerier/client"
+)
+
+func init() {
+	Register("parquet", func(opts Options) (Sink, error) {
+		if opts.Mapping == nil {
+			return nil, fmt.Errorf("parquet sink needs the index mapping")
+		}
+		rowGroupSize := opts.RowGroupRows
+		if rowGroupSize == 0 {
+			rowGroupSize = ParquetRowGroupRows
+		}
+		return NewParquetProcessor(opts.Path, opts.Mapping, rowGroupSize, opts.Metadata), nil
+	})
+}
+
+// parquetParallelism is the number of goroutines the writer marshals with.
+const parquetParallelism = 4
+
+// ParquetRowGroupRows is the default row group size of the parquet sink.
+// Readers skip and parallelize by row group, so groups should be large
+// whatever the page size of the export; the writer also cuts a group once
+// it holds 128 MiB.
+const ParquetRowGroupRows = 100000
+
+// ParquetProcessor writes hits to a Parquet file whose schema is derived
+// from the index mapping:
+//
+//	keyword, text, ip, ...      -> UTF8 string
+//	long                        -> INT64
+//	integer, short, byte        -> INT32
+//	double, scaled_float        -> DOUBLE
+//	float, half_float           -> FLOAT
+//	boolean                     -> BOOLEAN
+//	date, date_nanos            -> INT64 TIMESTAMP_MILLIS
+//	object                      -> group
+//	nested                      -> LIST of group
+//
+// Other field types are written as their JSON text. Every column is
+// optional; values that cannot be converted to the column type are written
+// as null. Elasticsearch lets any field hold an array, but only nested fields
+// become Parquet lists, so other multi-valued fields keep their first value.
+//
+// A row group is cut every rowGroupSize rows, or sooner once the rows
+// buffered reach 128 MiB.
+type ParquetProcessor struct {
+	filepath     string
+	mapping      func() (map[string]interface{}, error)
+	rowGroupSize int
+	metadata     bool
+
+	fields   []*parquetField
+	file     *os.File
+	w        *bufio.Writer
+	pw       *writer.JSONWriter
+	rowCount int
+}
+
+func NewParquetProcessor(filepath string, mapping func() (map[string]interface{}, error), rowGroupSize int, metadata bool) *ParquetProcessor {
+	if rowGroupSize < 1 {
+		rowGroupSize = 1
+	}
+	return &ParquetProcessor{
+		filepath:     filepath,
+		mapping:      mapping,
+		rowGroupSize: rowGroupSize,
+		metadata:     metadata,
+	}
+}
+
+func (p *ParquetProcessor) Open() error {
+	properties, err := p.mapping()
+	if err != nil {
+		return fmt.Errorf("failed to fetch mapping: %w", err)
+	}
+	p.fields = parquetFields(properties)
+	if p.metadata {
+		p.fields = append([]*parquetField{{name: "_id", kind: parquetString}}, p.fields...)
+	}
+	if len(p.fields) == 0 {
+		return fmt.Errorf("mapping has no fields to export")
+	}
+
+	schema, err := parquetSchema(p.fields)
+	if err != nil {
+		return err
+	}
+
+	file, err := openOutput(p.filepath)
+	if err != nil {
+		return err
+	}
+	p.file = file
+	p.w = newOutputWriter(file)
+	p.pw, err = writer.NewJSONWriterFromWriter(schema, p.w, parquetParallelism)
+	if err != nil {
+		closeOutput(file)
+		return fmt.Errorf("failed to create parquet writer: %w", err)
+	}
+	return nil
+}
+
+func (p *ParquetProcessor) Write(hits []client.Hit) error {
+	for _, hit := range hits {
+		row := parquetRow(p.fields, hit.Source)
+		if p.metadata {
+			row["_id"] = hit.ID
+		}
+		b, err := json.Marshal(row)
+		if err != nil {
+			return fmt.Errorf("failed to encode document %s: %w", hit.ID, err)
+		}
+		if err := p.pw.Write(string(b)); err != nil {
+			return fmt.Errorf("failed to write document %s: %w", hit.ID, err)
+		}
+
+		p.rowCount++
+		if p.rowCount%p.rowGroupSize == 0 {
+			if err := p.pw.Flush(true); err != nil {
+				return fmt.Errorf("failed to write row group: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+// Flush pushes buffered bytes to the file. Rows of an unfinished row group
+// stay buffered until the group is full or the sink is closed, since a row
+// group cannot be appended to once written.
+func (p *ParquetProcessor) Flush() error {
+	if err := p.w.Flush(); err != nil {
+		return fmt.Errorf("failed to flush file: %w", err)
+	}
+	return nil
+}
+
+func (p *ParquetProcessor) Close() error {
+	if err := p.pw.WriteStop(); err != nil {
+		closeOutput(p.file)
+		return fmt.Errorf("failed to finish parquet file: %w", err)
+	}
+	if err := p.Flush(); err != nil {
+		closeOutput(p.file)
+		return err
+	}
+	return closeOutput(p.file)
+}
+
+type parquetKind int
+
+const (
+	parquetString parquetKind = iota
+	parquetInt64
+	parquetInt32
+	parquetDouble
+	parquetFloat
+	parquetBool
+	parquetTimestamp
+	parquetGroup
+	parquetList
+	parquetJSON
+)
+
+// parquetField is one column, or group of columns, of the derived schema.
+type parquetField struct {
+	name   string
+	kind   parquetKind
+	fields []*parquetField
+}
+
+// parquetFields maps Elasticsearch mapping properties to schema fields,
+// sorted by name so the column order is stable.
+func parquetFields(properties map[string]interface{}) []*parquetField {
+	names := make([]string, 0, len(properties))
+	for name := range properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fields := make([]*parquetField, 0, len(names))
+	for _, name := range names {
+		prop, _ := properties[name].(map[string]interface{})
+		esType, _ := prop["type"].(string)
+		children, hasChildren := prop["properties"].(map[string]interface{})
+
+		field := &parquetField{name: name}
+		switch {
+		case esType == "nested":
+			field.kind = parquetList
+			field.fields = parquetFields(children)
+		case esType == "object" || (esType == "" && hasChildren):
+			field.kind = parquetGroup
+			field.fields = parquetFields(children)
+		default:
+			field.kind = parquetKindOf(esType)
+		}
+		if (field.kind == parquetGroup || field.kind == parquetList) && len(field.fields) == 0 {
+			// Parquet has no empty groups; keep the raw JSON instead.
+			field.kind = parquetJSON
+		}
+		fields = append(fields, field)
+	}
+	return fields
+}
+
+func parquetKindOf(esType string) parquetKind {
+	switch esType {
+	case "keyword", "constant_keyword", "wildcard", "text", "match_only_text",
+		"search_as_you_type", "ip", "version", "unsigned_long":
+		return parquetString
+	case "long":
+		return parquetInt64
+	case "integer", "short", "byte":
+		return parquetInt32
+	case "double", "scaled_float":
+		return parquetDouble
+	case "float", "half_float":
+		return parquetFloat
+	case "boolean":
+		return parquetBool
+	case "date", "date_nanos":
+		return parquetTimestamp
+	default:
+		return parquetJSON
+	}
+}
+
+// schemaNode is the JSON schema format understood by the parquet writer.
+type schemaNode struct {
+	Tag    string        `json:"Tag"`
+	Fields []*schemaNode `json:"Fields,omitempty"`
+}
+
+func parquetSchema(fields []*parquetField) (string, error) {
+	root := &schemaNode{
+		Tag:    "name=parquet_go_root, repetitiontype=REQUIRED",
+		Fields: schemaNodes(fields),
+	}
+	b, err := json.Marshal(root)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode parquet schema: %w", err)
+	}
+	return string(b), nil
+}
+
+func schemaNodes(fields []*parquetField) []*schemaNode {
+	nodes := make([]*schemaNode, len(fields))
+	for i, field := range fields {
+		node := &schemaNode{}
+		switch field.kind {
+		case parquetGroup:
+			node.Tag = fmt.Sprintf("name=%s, repetitiontype=OPTIONAL", field.name)
+			node.Fields = schemaNodes(field.fields)
+		case parquetList:
+			node.Tag = fmt.Sprintf("name=%s, type=LIST, repetitiontype=OPTIONAL", field.name)
+			node.Fields = []*schemaNode{{
+				Tag:    "name=element, repetitiontype=REQUIRED",
+				Fields: schemaNodes(field.fields),
+			}}
+		default:
+			node.Tag = fmt.Sprintf("name=%s, %s, repetitiontype=OPTIONAL", field.name, scalarTag(field.kind))
+		}
+		nodes[i] = node
+	}
+	return nodes
+}
+
+func scalarTag(kind parquetKind) string {
+	switch kind {
+	case parquetInt64:
+		return "type=INT64"
+	case parquetInt32:
+		return "type=INT32"
+	case parquetDouble:
+		return "type=DOUBLE"
+	case parquetFloat:
+		return "type=FLOAT"
+	case parquetBool:
+		return "type=BOOLEAN"
+	case parquetTimestamp:
+		return "type=INT64, convertedtype=TIMESTAMP_MILLIS"
+	default:
+		return "type=BYTE_ARRAY, convertedtype=UTF8"
+	}
+}
+
+// parquetRow converts a _source document into a row matching fields.
+// Fields that are missing or cannot be converted are left out, which the
+// writer stores as null.
+func parquetRow(fields []*parquetField, source map[string]interface{}) map[string]interface{} {
+	row := make(map[string]interface{}, len(fields))
+	for _, field := range fields {
+		if value, ok := parquetValue(field, source[field.name]); ok {
+			row[field.name] = value
+		}
+	}
+	return row
+}
+
+func parquetValue(field *parquetField, v interface{}) (interface{}, bool) {
+	if v == nil {
+		return nil, false
+	}
+
+	switch field.kind {
+	case parquetList:
+		var elems []interface{}
+		switch v := v.(type) {
+		case []interface{}:
+			elems = v
+		default:
+			elems = []interface{}{v}
+		}
+		list := make([]interface{}, 0, len(elems))
+		for _, elem := range elems {
+			if m, ok := elem.(map[string]interface{}); ok {
+				list = append(list, parquetRow(field.fields, m))
+			}
+		}
+		return list, true
+	case parquetJSON:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return nil, false
+		}
+		return string(b), true
+	}
+
+	// Everything else is a single value; keep the first of an array.
+	if arr, ok := v.([]interface{}); ok {
+		if len(arr) == 0 {
+			return nil, false
+		}
+		v = arr[0]
+	}
+
+	switch field.kind {
+	case parquetGroup:
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		return parquetRow(field.fields, m), true
+	case parquetString:
+		return formatValue(v), true
+	case parquetInt64, parquetInt32:
+		n, err := strconv.ParseInt(formatValue(v), 10, 64)
+		if err != nil {
+			f, ferr := strconv.ParseFloat(formatValue(v), 64)
+			if ferr != nil {
+				return nil, false
+			}
+			n = int64(f)
+		}
+		return n, true
+	case parquetDouble, parquetFloat:
+		f, err := strconv.ParseFloat(formatValue(v), 64)
+		if err != nil {
+			return nil, false
+		}
+		return f, true
+	case parquetBool:
+		b, err := strconv.ParseBool(formatValue(v))
+		if err != nil {
+			return nil, false
+		}
+		return b, true
+	case parquetTimestamp:
+		return parseTimestampMillis(v)
+	}
+	return nil, false
+}
+
+// timestampLayouts are the date formats tried for string dates, covering the
+// default strict_date_optional_time format.
+var timestampLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02T15:04:05Z0700",
+	"2006-01-02T15:04",
+	"2006-01-02",
+}
+
+// parseTimestampMillis converts a date value, either epoch milliseconds or
+// a date string, to epoch milliseconds.
+func parseTimestampMillis(v interface{}) (interface{}, bool) {
+	s := strings.TrimSpace(formatValue(v))
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return n, true
+	}
+	for _, layout := range timestampLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.UnixMilli(), true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,103 @@
+package processor
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/xitongsys/parquet-go-source/local"
+	"github.com/xitongsys/parquet-go/reader"
+
+	"github.com/terenzio/ElasticSearchQuerier/client"
+)
+
+func TestParquetProcessorRoundTrip(t *testing.T) {
+	var mapping map[string]interface{}
+	err := json.Unmarshal([]byte(`{
+		"title":   {"type": "keyword"},
+		"views":   {"type": "long"},
+		"created": {"type": "date"},
+		"user":    {"properties": {"name": {"type": "text"}}},
+		"tags":    {"type": "nested", "properties": {"label": {"type": "keyword"}}}
+	}`), &mapping)
+	if err != nil {
+		t.Fatalf("Error parsing mapping: %s", err)
+	}
+
+	docs := []string{
+		`{"title": "Document 1", "views": 10, "created": "2024-05-01T12:00:00Z",
+		  "user": {"name": "Ann"}, "tags": [{"label": "a"}, {"label": "b"}]}`,
+		`{"title": "Document 2", "views": "oops"}`,
+		`{"title": "Document 3", "created": 1714564800000}`,
+	}
+	hits := make([]client.Hit, len(docs))
+	for i, doc := range docs {
+		dec := json.NewDecoder(strings.NewReader(doc))
+		dec.UseNumber()
+		if err := dec.Decode(&hits[i].Source); err != nil {
+			t.Fatalf("Error parsing document: %s", err)
+		}
+	}
+
+	tmpFile, err := os.CreateTemp("", "test_export_*.parquet")
+	if err != nil {
+		t.Fatalf("Error creating temporary file: %s", err)
+	}
+	tmpFile.Close()
+	defer os.Remove(tmpFile.Name())
+
+	// A row group size of 2 splits the three rows over two row groups.
+	sink, err := New("parquet", Options{
+		Path: tmpFile.Name(),
+		Mapping: func() (map[string]interface{}, error) {
+			return mapping, nil
+		},
+		RowGroupRows: 2,
+	})
+	if err != nil {
+		t.Fatalf("Error creating sink: %s", err)
+	}
+	if err := sink.Open(); err != nil {
+		t.Fatalf("Error opening sink: %s", err)
+	}
+	if err := sink.Write(hits); err != nil {
+		t.Fatalf("Error writing hits: %s", err)
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatalf("Error closing sink: %s", err)
+	}
+
+	// Read the file back
+	fr, err := local.NewLocalFileReader(tmpFile.Name())
+	if err != nil {
+		t.Fatalf("Error opening parquet file: %s", err)
+	}
+	defer fr.Close()
+	pr, err := reader.NewParquetReader(fr, nil, 1)
+	if err != nil {
+		t.Fatalf("Error reading parquet file: %s", err)
+	}
+	defer pr.ReadStop()
+
+	if n := len(pr.Footer.RowGroups); n != 2 {
+		t.Errorf("Expected 2 row groups but got %d", n)
+	}
+	rows, err := pr.ReadByNumber(int(pr.GetNumRows()))
+	if err != nil {
+		t.Fatalf("Error reading rows: %s", err)
+	}
+	got, err := json.Marshal(rows)
+	if err != nil {
+		t.Fatalf("Error encoding rows: %s", err)
+	}
+
+	expected := `[` +
+		`{"Created":1714564800000,"Tags":[{"Label":"a"},{"Label":"b"}],"Title":"Document 1","User":{"Name":"Ann"},"Views":10},` +
+		`{"Created":null,"Tags":null,"Title":"Document 2","User":null,"Views":null},` +
+		`{"Created":1714564800000,"Tags":null,"Title":"Document 3","User":null,"Views":null}` +
+		`]`
+	if string(got) != expected {
+		t.Errorf("Expected %s but got %s", expected, got)
+	}
+}
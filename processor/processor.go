@@ -2,26 +2,60 @@
 package processor
 
 import (
+	"bufio"
 	"fmt"
+	"io"
 	"os"
+
+	"github.com/terenzio/ElasticSearchQuerier/client"
 )
 
+func init() {
+	Register("file", func(opts Options) (Sink, error) {
+		return NewFileProcessor(opts.Path), nil
+	})
+	Register("stdout", func(opts Options) (Sink, error) {
+		return NewFileProcessor("-"), nil
+	})
+}
+
+// FileProcessor writes the "title" field of every hit to a file, one per line.
 type FileProcessor struct {
-	file *os.File
+	filepath string
+	file     *os.File
+	w        *bufio.Writer
 }
 
-func NewFileProcessor(filepath string) (*FileProcessor, error) {
-	file, err := os.Create(filepath)
+// NewFileProcessor returns a sink writing to filepath, or to standard output
+// if filepath is "-". The file is created by Open.
+func NewFileProcessor(filepath string) *FileProcessor {
+	return &FileProcessor{filepath: filepath}
+}
+
+func (p *FileProcessor) Open() error {
+	file, err := openOutput(p.filepath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create output file: %w", err)
+		return err
 	}
-	return &FileProcessor{file: file}, nil
+	p.file = file
+	p.w = newOutputWriter(file)
+	return nil
 }
 
-func (p *FileProcessor) ProcessHits(hits []map[string]interface{}) error {
+func (p *FileProcessor) Resume(offset int64) error {
+	file, err := resumeOutput(p.filepath, offset)
+	if err != nil {
+		return err
+	}
+	p.file = file
+	p.w = newOutputWriter(file)
+	return nil
+}
+
+func (p *FileProcessor) Write(hits []client.Hit) error {
 	for _, hit := range hits {
-		if message, ok := hit["title"]; ok {
-			if _, err := p.file.WriteString(fmt.Sprintf("%s\n", message)); err != nil {
+		if message, ok := hit.Source["title"]; ok {
+			if _, err := fmt.Fprintf(p.w, "%s\n", message); err != nil {
 				return fmt.Errorf("failed to write to file: %w", err)
 			}
 		}
@@ -29,6 +63,82 @@ func (p *FileProcessor) ProcessHits(hits []map[string]interface{}) error {
 	return nil
 }
 
+func (p *FileProcessor) Flush() error {
+	if err := p.w.Flush(); err != nil {
+		return fmt.Errorf("failed to flush file: %w", err)
+	}
+	return nil
+}
+
+func (p *FileProcessor) Offset() (int64, error) {
+	if err := p.Flush(); err != nil {
+		return 0, err
+	}
+	return outputOffset(p.file)
+}
+
 func (p *FileProcessor) Close() error {
-	return p.file.Close()
+	if err := p.Flush(); err != nil {
+		return err
+	}
+	return closeOutput(p.file)
+}
+
+// openOutput creates the file at filepath, or returns standard output for "-".
+func openOutput(filepath string) (*os.File, error) {
+	if filepath == "-" {
+		return os.Stdout, nil
+	}
+	file, err := os.Create(filepath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create output file: %w", err)
+	}
+	return file, nil
+}
+
+// resumeOutput opens the existing file at filepath for writing at offset,
+// truncating whatever follows it.
+func resumeOutput(filepath string, offset int64) (*os.File, error) {
+	if filepath == "-" {
+		return nil, fmt.Errorf("cannot resume writing to standard output")
+	}
+	file, err := os.OpenFile(filepath, os.O_RDWR, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open output file: %w", err)
+	}
+	info, err := file.Stat()
+	if err == nil && info.Size() < offset {
+		err = fmt.Errorf("file has %d bytes, checkpoint expects at least %d", info.Size(), offset)
+	}
+	if err == nil {
+		err = file.Truncate(offset)
+	}
+	if err == nil {
+		_, err = file.Seek(offset, io.SeekStart)
+	}
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to resume output file: %w", err)
+	}
+	return file, nil
+}
+
+// outputOffset returns the position the next write to file goes to.
+func outputOffset(file *os.File) (int64, error) {
+	if file == os.Stdout {
+		return 0, fmt.Errorf("standard output has no offset")
+	}
+	offset, err := file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get output offset: %w", err)
+	}
+	return offset, nil
+}
+
+// closeOutput closes file unless it is standard output.
+func closeOutput(file *os.File) error {
+	if file == os.Stdout {
+		return nil
+	}
+	return file.Close()
 }
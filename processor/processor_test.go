@@ -0,0 +1,132 @@
+package processor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/terenzio/ElasticSearchQuerier/client"
+)
+
+func TestFileProcessorWrite(t *testing.T) {
+	// Mock data simulating the _source of Elasticsearch hits
+	hits := []client.Hit{
+		{Source: map[string]interface{}{"title": "Test message 1"}},
+		{Source: map[string]interface{}{"title": "Test message 2"}},
+		{Source: map[string]interface{}{"message": "no title"}},
+	}
+
+	// Create a temporary file to write the output
+	tmpFile, err := os.CreateTemp("", "test_logs_*.txt")
+	if err != nil {
+		t.Fatalf("Error creating temporary file: %s", err)
+	}
+	tmpFile.Close()
+	defer os.Remove(tmpFile.Name())
+
+	// Write the hits through the registered file sink
+	sink, err := New("file", Options{Path: tmpFile.Name()})
+	if err != nil {
+		t.Fatalf("Error creating sink: %s", err)
+	}
+	if err := sink.Open(); err != nil {
+		t.Fatalf("Error opening sink: %s", err)
+	}
+	if err := sink.Write(hits); err != nil {
+		t.Fatalf("Error writing hits: %s", err)
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatalf("Error closing sink: %s", err)
+	}
+
+	// Read the content of the file
+	content, err := os.ReadFile(tmpFile.Name())
+	if err != nil {
+		t.Fatalf("Error reading temporary file: %s", err)
+	}
+
+	// Expected output
+	expected := "Test message 1\nTest message 2\n"
+
+	// Compare the content with the expected output
+	if string(content) != expected {
+		t.Errorf("Expected %q but got %q", expected, string(content))
+	}
+}
+
+func TestNewUnknownSink(t *testing.T) {
+	if _, err := New("carrier-pigeon", Options{}); err == nil {
+		t.Errorf("Expected an error for an unknown sink")
+	}
+}
+
+func TestJSONLProcessorMetadata(t *testing.T) {
+	seqNo := int64(7)
+	hits := []client.Hit{{
+		ID:     "1",
+		Index:  "sample_data",
+		SeqNo:  &seqNo,
+		Source: map[string]interface{}{"title": "Document <1>"},
+	}}
+
+	tmpFile, err := os.CreateTemp("", "test_logs_*.jsonl")
+	if err != nil {
+		t.Fatalf("Error creating temporary file: %s", err)
+	}
+	tmpFile.Close()
+	defer os.Remove(tmpFile.Name())
+
+	sink := NewJSONLProcessor(tmpFile.Name(), true)
+	if err := sink.Open(); err != nil {
+		t.Fatalf("Error opening sink: %s", err)
+	}
+	if err := sink.Write(hits); err != nil {
+		t.Fatalf("Error writing hits: %s", err)
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatalf("Error closing sink: %s", err)
+	}
+
+	content, err := os.ReadFile(tmpFile.Name())
+	if err != nil {
+		t.Fatalf("Error reading temporary file: %s", err)
+	}
+
+	expected := `{"_id":"1","_index":"sample_data","_seq_no":7,"_source":{"title":"Document <1>"}}` + "\n"
+	if string(content) != expected {
+		t.Errorf("Expected %q but got %q", expected, string(content))
+	}
+}
+
+func TestDeadLetterCreatedOnFirstWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dead_letter.jsonl")
+	deadLetter := NewDeadLetter(path, false)
+
+	if err := deadLetter.Write(0, 1, nil); err != nil {
+		t.Fatalf("Error writing dead letters: %s", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("Expected no file before the first malformed hit, got %v", err)
+	}
+
+	hits := []client.MalformedHit{{Raw: []byte(`{"_source":{}}`), Err: fmt.Errorf("%w: missing _id", client.ErrMalformedHit)}}
+	if err := deadLetter.Write(1, 3, hits); err != nil {
+		t.Fatalf("Error writing dead letters: %s", err)
+	}
+	if err := deadLetter.Close(); err != nil {
+		t.Fatalf("Error closing dead letters: %s", err)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Error reading dead letters: %s", err)
+	}
+	expected := `{"slice":1,"page":3,"error":"malformed hit: missing _id","hit":{"_source":{}}}` + "\n"
+	if string(content) != expected {
+		t.Errorf("Expected %q but got %q", expected, string(content))
+	}
+	if deadLetter.Count() != 1 {
+		t.Errorf("Expected 1 dead letter but got %d", deadLetter.Count())
+	}
+}
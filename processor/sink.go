@@ -0,0 +1,108 @@
+// processor/sink.go
+package processor
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/terenzio/ElasticSearchQuerier/client"
+)
+
+// Sink is a destination for exported hits. Open is called once before the
+// first Write, Write once per page, and Close once at the end. Flush pushes
+// anything buffered to the destination; Close flushes before releasing it.
+type Sink interface {
+	Open() error
+	Write(hits []client.Hit) error
+	Flush() error
+	Close() error
+}
+
+// Resumable is implemented by sinks that can continue an output left
+// behind by an interrupted export.
+type Resumable interface {
+	Sink
+	// Offset flushes the sink and returns the size of its output so far.
+	Offset() (int64, error)
+	// Resume is called instead of Open. It opens the existing output,
+	// discards everything after offset, a value previously returned by
+	// Offset, and appends from there.
+	Resume(offset int64) error
+}
+
+var (
+	_ Resumable = (*FileProcessor)(nil)
+	_ Resumable = (*JSONLProcessor)(nil)
+	_ Resumable = (*CSVProcessor)(nil)
+	_ Resumable = (*BulkProcessor)(nil)
+)
+
+// Options carries the settings a Factory may need to build its sink.
+type Options struct {
+	// Path is the output location; "-" means standard output.
+	Path string
+	// Metadata asks sinks that support it to include _id, _index and the
+	// other hit metadata alongside _source.
+	Metadata bool
+	// Columns lists the dotted field paths written by tabular sinks.
+	Columns []string
+	// ArrayMode is how tabular sinks render multi-valued fields: ArrayJoin,
+	// ArrayJSON or ArrayFirst. ArraySeparator is used by ArrayJoin.
+	ArrayMode      string
+	ArraySeparator string
+	// Mapping returns the "properties" of the index mapping, for sinks whose
+	// output schema is derived from it. It is only called by such sinks.
+	Mapping func() (map[string]interface{}, error)
+	// RowGroupRows is the number of rows per Parquet row group. It defaults
+	// to ParquetRowGroupRows.
+	RowGroupRows int
+}
+
+// Factory builds an unopened Sink.
+type Factory func(opts Options) (Sink, error)
+
+var (
+	factoriesMu sync.RWMutex
+	factories   = make(map[string]Factory)
+)
+
+// Register makes a sink available to New under name. It panics if name is
+// already taken, so it is meant to be called from init functions.
+func Register(name string, factory Factory) {
+	factoriesMu.Lock()
+	defer factoriesMu.Unlock()
+
+	if factory == nil {
+		panic("processor: Register factory is nil")
+	}
+	if _, dup := factories[name]; dup {
+		panic("processor: Register called twice for sink " + name)
+	}
+	factories[name] = factory
+}
+
+// New builds the sink registered under name.
+func New(name string, opts Options) (Sink, error) {
+	factoriesMu.RLock()
+	factory, ok := factories[name]
+	factoriesMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unknown sink %q (available: %v)", name, Names())
+	}
+	return factory(opts)
+}
+
+// Names returns the registered sink names in sorted order.
+func Names() []string {
+	factoriesMu.RLock()
+	defer factoriesMu.RUnlock()
+
+	names := make([]string, 0, len(factories))
+	for name := range factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,369 @@
+// querier/querier.go
+package querier
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v8"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/terenzio/ElasticSearchQuerier/client"
+	"github.com/terenzio/ElasticSearchQuerier/logging"
+	"github.com/terenzio/ElasticSearchQuerier/processor"
+)
+
+// DefaultQuery is the query run when none is given.
+const DefaultQuery = `{"query":{"match_all":{}}}`
+
+// ErrStopped is returned by Export after Stop was called.
+var ErrStopped = errors.New("export stopped")
+
+var tracer = otel.Tracer("github.com/terenzio/ElasticSearchQuerier/querier")
+
+// Querier exports the documents matching a query from an index to a sink.
+// It is the library form of the export command: the same pagination modes,
+// sliced workers, streaming, retries and recovery of expired search
+// contexts, configured with options rather than a config file.
+//
+// Cancelling the context passed to Export or Iterate aborts the search at
+// once, releases the scroll or point in time and closes the sink. Stop ends
+// an export more gently, after the page being written.
+type Querier struct {
+	es         *elasticsearch.Client
+	index      string
+	query      string
+	batchSize  int
+	keepAlive  time.Duration
+	pagination string
+	workers    int
+	stream     bool
+
+	sink       processor.Sink
+	deadLetter *processor.DeadLetter
+	progress   Progress
+	from       []client.Position
+	offset     int64
+	logger     *slog.Logger
+	retry      client.RetryPolicy
+
+	stopped atomic.Bool
+}
+
+// Option configures a Querier.
+type Option func(*Querier)
+
+// WithIndex sets the index, alias or pattern to search. It is required.
+func WithIndex(index string) Option {
+	return func(q *Querier) { q.index = index }
+}
+
+// WithQuery sets the search body. It defaults to DefaultQuery.
+func WithQuery(query string) Option {
+	return func(q *Querier) { q.query = query }
+}
+
+// WithBatchSize sets the number of hits fetched per page. It defaults to
+// 1000.
+func WithBatchSize(n int) Option {
+	return func(q *Querier) { q.batchSize = n }
+}
+
+// WithKeepAlive sets how long the scroll or point in time is kept open
+// between pages. It defaults to a minute.
+func WithKeepAlive(d time.Duration) Option {
+	return func(q *Querier) { q.keepAlive = d }
+}
+
+// WithPagination selects client.ModeScroll (the default) or client.ModePIT.
+func WithPagination(mode string) Option {
+	return func(q *Querier) { q.pagination = mode }
+}
+
+// WithWorkers splits the search into n slices fetched concurrently.
+func WithWorkers(n int) Option {
+	return func(q *Querier) { q.workers = n }
+}
+
+// WithStreaming sets whether hits are written to the sink as they are read
+// off the response when there is a single worker. It is on by default.
+func WithStreaming(stream bool) Option {
+	return func(q *Querier) { q.stream = stream }
+}
+
+// WithSink sets where Export writes. Export opens and closes it, and records
+// what it writes in the metrics package.
+func WithSink(sink processor.Sink) Option {
+	return func(q *Querier) { q.sink = sink }
+}
+
+// WithDeadLetter sets where hits that cannot be parsed are recorded. By
+// default they are only logged. The caller closes it.
+func WithDeadLetter(deadLetter *processor.DeadLetter) Option {
+	return func(q *Querier) { q.deadLetter = deadLetter }
+}
+
+// WithProgress sets a Progress told about every page Export writes.
+func WithProgress(progress Progress) Option {
+	return func(q *Querier) { q.progress = progress }
+}
+
+// WithResume continues an interrupted export: slice i of the search
+// continues from from[i], and the sink, which must be a
+// processor.Resumable, from offset. The number of workers is len(from).
+func WithResume(from []client.Position, offset int64) Option {
+	return func(q *Querier) {
+		q.from = from
+		q.offset = offset
+	}
+}
+
+// WithLogger sets where the export logs, with an "index" field added. It
+// defaults to slog.Default(). Every page is logged at info level, with its
+// scroll ID and how long it took added at debug level.
+func WithLogger(logger *slog.Logger) Option {
+	return func(q *Querier) { q.logger = logger }
+}
+
+// WithRetryPolicy sets how failed requests are retried. It defaults to
+// client.DefaultRetryPolicy().
+func WithRetryPolicy(policy client.RetryPolicy) Option {
+	return func(q *Querier) { q.retry = policy }
+}
+
+// Progress is told about the pages written by Export, so their position can
+// be recorded, for instance in a checkpoint.
+type Progress interface {
+	// Written is called once the sink has accepted a page.
+	Written(page *client.Page) error
+	// Stopped is called if the export fails while the sink holds exactly
+	// the pages passed to Written, before the sink is closed.
+	Stopped() error
+}
+
+// New returns a Querier searching with es.
+func New(es *elasticsearch.Client, opts ...Option) (*Querier, error) {
+	q := &Querier{
+		es:         es,
+		query:      DefaultQuery,
+		batchSize:  1000,
+		keepAlive:  time.Minute,
+		pagination: client.ModeScroll,
+		workers:    1,
+		stream:     true,
+		retry:      client.DefaultRetryPolicy(),
+	}
+	for _, opt := range opts {
+		opt(q)
+	}
+	if q.from != nil {
+		q.workers = len(q.from)
+	}
+	if q.logger == nil {
+		q.logger = slog.Default()
+	}
+	q.logger = q.logger.With("index", q.index)
+	if q.sink != nil {
+		q.sink = processor.Instrument(q.sink)
+		processor.SetLogger(q.sink, q.logger)
+	}
+
+	switch {
+	case q.index == "":
+		return nil, errors.New("an index is required")
+	case q.batchSize < 1:
+		return nil, fmt.Errorf("batch size must be positive, got %d", q.batchSize)
+	case q.workers < 1:
+		return nil, fmt.Errorf("workers must be positive, got %d", q.workers)
+	}
+	if _, err := q.newSearcher(); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+func (q *Querier) newSearcher() (client.Searcher, error) {
+	searcher, err := client.NewSearcher(q.pagination, q.es, q.keepAlive, q.batchSize, q.index)
+	if err != nil {
+		return nil, err
+	}
+	if s, ok := searcher.(client.Logger); ok {
+		s.SetLogger(q.logger)
+	}
+	if s, ok := searcher.(client.Retrier); ok {
+		s.SetRetryPolicy(q.retry)
+	}
+	return searcher, nil
+}
+
+// Stats summarizes the pages handled by an export.
+type Stats struct {
+	Pages      int
+	Documents  int
+	Malformed  int
+	Recoveries int
+}
+
+func (s *Stats) add(page *client.Page) {
+	s.Pages++
+	s.Documents += len(page.Hits) + page.Streamed
+	s.Malformed += len(page.Malformed)
+	if page.Recovered {
+		s.Recoveries++
+	}
+}
+
+func (s Stats) String() string {
+	return fmt.Sprintf("%d documents in %d pages, %d malformed hits, %d expired search contexts re-established",
+		s.Documents, s.Pages, s.Malformed, s.Recoveries)
+}
+
+// Export runs the search and writes every hit to the sink. The returned
+// Stats cover the pages handled, also when Export fails. The whole export
+// is traced as one span, parent of the spans of the search requests and
+// of the sink's flushes.
+func (q *Querier) Export(ctx context.Context) (stats Stats, err error) {
+	if q.sink == nil {
+		return stats, errors.New("no sink to export to")
+	}
+	ctx, span := tracer.Start(ctx, "Export", trace.WithAttributes(
+		attribute.String("index", q.index),
+		attribute.String("pagination", q.pagination),
+		attribute.Int("workers", q.workers),
+		attribute.Int("batch_size", q.batchSize),
+	))
+	defer func() {
+		span.SetAttributes(
+			attribute.Int("documents", stats.Documents),
+			attribute.Int("pages", stats.Pages),
+		)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+	processor.SetTraceContext(q.sink, ctx)
+
+	if err := q.openSink(); err != nil {
+		return stats, fmt.Errorf("failed to open sink: %w", err)
+	}
+
+	deadLetter := q.deadLetter
+	if deadLetter == nil {
+		deadLetter = processor.NewDeadLetter("", false)
+		deadLetter.SetLogger(q.logger)
+	}
+	from := q.from
+	if from == nil {
+		from = make([]client.Position, q.workers)
+	}
+
+	sinkFailed := false
+	// Streamed hits of a page Progress has not been told about yet
+	pending := 0
+	// When each slice last handed over a page, to time the next one
+	last := make(map[int]time.Time, len(from))
+	start := time.Now()
+	handle := func(page *client.Page) error {
+		since, ok := last[page.Slice]
+		if !ok {
+			since = start
+		}
+		last[page.Slice] = time.Now()
+		args := []any{"slice", page.Slice, "page", page.Number, "total_pages", page.TotalPages,
+			"docs", len(page.Hits) + page.Streamed, "malformed", len(page.Malformed)}
+		if q.logger.Enabled(ctx, slog.LevelDebug) {
+			args = append(args, logging.ScrollID(page.ScrollID), "duration", time.Since(since))
+		}
+		q.logger.Info("Processing page", args...)
+		stats.add(page)
+		pending = 0
+		if err := deadLetter.Write(page.Slice, page.Number, page.Malformed); err != nil {
+			return err
+		}
+		if err := q.sink.Write(page.Hits); err != nil {
+			sinkFailed = true
+			return fmt.Errorf("failed to process hits: %w", err)
+		}
+		if q.progress != nil {
+			if err := q.progress.Written(page); err != nil {
+				sinkFailed = true
+				return fmt.Errorf("failed to record progress: %w", err)
+			}
+		}
+		if q.stopped.Load() {
+			return ErrStopped
+		}
+		return nil
+	}
+
+	if q.stream && len(from) == 1 {
+		// Write each hit as it is read off the response, so large pages are
+		// never held in memory as a whole
+		err = client.StreamSearchFrom(ctx, q.newSearcher, q.query, from[0], func(hit client.Hit) error {
+			pending++
+			if err := q.sink.Write([]client.Hit{hit}); err != nil {
+				sinkFailed = true
+				return fmt.Errorf("failed to process hits: %w", err)
+			}
+			return nil
+		}, handle)
+	} else {
+		// Fetch all slices concurrently and write their pages as they are merged
+		err = client.SlicedSearchFrom(ctx, q.newSearcher, q.query, from, handle)
+	}
+	if err != nil {
+		// Report the pages written so far, unless the sink itself failed or
+		// a page was only partly streamed, either of which may have written
+		// hits Progress knows nothing about.
+		if q.progress != nil && !sinkFailed && pending == 0 {
+			if err := q.progress.Stopped(); err != nil {
+				q.logger.Warn("Failed to record progress", "error", err)
+			}
+		}
+		q.sink.Close()
+		return stats, fmt.Errorf("failed to export: %w", err)
+	}
+	q.logger.Debug("No more hits to process", "duration", time.Since(start))
+
+	if err := q.sink.Close(); err != nil {
+		return stats, fmt.Errorf("failed to close sink: %w", err)
+	}
+	return stats, nil
+}
+
+// Stop makes a running Export return ErrStopped once the page in hand has
+// been written, so the output and Progress end on the same page. It may be
+// called from any goroutine, for instance on a signal.
+func (q *Querier) Stop() {
+	q.stopped.Store(true)
+}
+
+func (q *Querier) openSink() error {
+	if q.from == nil {
+		return q.sink.Open()
+	}
+	resumable, ok := q.sink.(processor.Resumable)
+	if !ok {
+		return fmt.Errorf("sink %T cannot resume", q.sink)
+	}
+	return resumable.Resume(q.offset)
+}
+
+// Iterate runs the search and calls fn with every hit, its _source decoded
+// into T; see client.Iterate. Workers and resume positions do not apply.
+func Iterate[T any](ctx context.Context, q *Querier, fn func(client.Document[T]) error) error {
+	searcher, err := q.newSearcher()
+	if err != nil {
+		return err
+	}
+	return client.Iterate(ctx, searcher, q.query, fn)
+}
@@ -0,0 +1,243 @@
+package querier
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v8"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/terenzio/ElasticSearchQuerier/client"
+	"github.com/terenzio/ElasticSearchQuerier/estest"
+)
+
+// recordingSink keeps the IDs of the hits written to it.
+type recordingSink struct {
+	ids    []string
+	opened bool
+	closed bool
+}
+
+func (s *recordingSink) Open() error  { s.opened = true; return nil }
+func (s *recordingSink) Flush() error { return nil }
+func (s *recordingSink) Close() error { s.closed = true; return nil }
+
+func (s *recordingSink) Write(hits []client.Hit) error {
+	for _, hit := range hits {
+		s.ids = append(s.ids, hit.ID)
+	}
+	return nil
+}
+
+// newTestClient returns a client for a server holding three documents,
+// served two per page from a scroll.
+func newTestClient(t *testing.T) *elasticsearch.Client {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Elastic-Product", "Elasticsearch")
+		w.Header().Set("Content-Type", "application/json")
+
+		switch {
+		case r.URL.Path == "/logs/_search":
+			fmt.Fprint(w, `{"_scroll_id":"s1","hits":{"total":{"value":3},"hits":[
+				{"_index":"logs","_id":"1","_source":{"title":"a"}},
+				{"_index":"logs","_id":"2","_source":{"title":"b"}}]}}`)
+		case r.Method == http.MethodDelete:
+			fmt.Fprint(w, `{"succeeded":true}`)
+		case r.URL.Query().Get("scroll_id") == "s1":
+			fmt.Fprint(w, `{"_scroll_id":"s2","hits":{"hits":[{"_index":"logs","_id":"3","_source":{"title":"c"}}]}}`)
+		default:
+			fmt.Fprint(w, `{"_scroll_id":"s2","hits":{"hits":[]}}`)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	es, err := elasticsearch.NewClient(elasticsearch.Config{Addresses: []string{server.URL}})
+	if err != nil {
+		t.Fatalf("Error creating client: %s", err)
+	}
+	return es
+}
+
+func TestExport(t *testing.T) {
+	for _, stream := range []bool{true, false} {
+		sink := &recordingSink{}
+		q, err := New(newTestClient(t), WithIndex("logs"), WithBatchSize(2), WithStreaming(stream), WithSink(sink))
+		if err != nil {
+			t.Fatalf("Error creating querier: %s", err)
+		}
+		stats, err := q.Export(context.Background())
+		if err != nil {
+			t.Fatalf("Error exporting: %s", err)
+		}
+
+		if strings.Join(sink.ids, " ") != "1 2 3" {
+			t.Errorf("Expected documents 1 2 3 with streaming %t but got %v", stream, sink.ids)
+		}
+		if !sink.opened || !sink.closed {
+			t.Errorf("Expected the sink to be opened and closed")
+		}
+		if stats.Pages != 2 || stats.Documents != 3 {
+			t.Errorf("Expected 3 documents in 2 pages but got %s", stats)
+		}
+	}
+}
+
+// recordingProgress counts the pages written and whether the export was
+// reported as stopped.
+type recordingProgress struct {
+	pages   int
+	stopped bool
+}
+
+func (p *recordingProgress) Written(page *client.Page) error { p.pages++; return nil }
+func (p *recordingProgress) Stopped() error                  { p.stopped = true; return nil }
+
+func TestExportStopsAfterPage(t *testing.T) {
+	sink := &recordingSink{}
+	progress := &recordingProgress{}
+	q, err := New(newTestClient(t), WithIndex("logs"), WithBatchSize(2), WithSink(sink), WithProgress(progress))
+	if err != nil {
+		t.Fatalf("Error creating querier: %s", err)
+	}
+	// A stop requested early still lets the first page be written.
+	q.Stop()
+
+	stats, err := q.Export(context.Background())
+	if !errors.Is(err, ErrStopped) {
+		t.Fatalf("Expected ErrStopped but got %v", err)
+	}
+	if strings.Join(sink.ids, " ") != "1 2" || stats.Pages != 1 {
+		t.Errorf("Expected only the first page to be written but got %v", sink.ids)
+	}
+	if progress.pages != 1 || !progress.stopped {
+		t.Errorf("Expected progress of one page to be saved but got %+v", progress)
+	}
+	if !sink.closed {
+		t.Errorf("Expected the sink to be closed")
+	}
+}
+
+func TestExportLogsPages(t *testing.T) {
+	for _, level := range []slog.Level{slog.LevelInfo, slog.LevelDebug} {
+		var buf bytes.Buffer
+		logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: level}))
+		q, err := New(newTestClient(t), WithIndex("logs"), WithBatchSize(2), WithSink(&recordingSink{}), WithLogger(logger))
+		if err != nil {
+			t.Fatalf("Error creating querier: %s", err)
+		}
+		if _, err := q.Export(context.Background()); err != nil {
+			t.Fatalf("Error exporting: %s", err)
+		}
+
+		// Progress is reported at info level, the timings only at debug
+		if n := strings.Count(buf.String(), `level=INFO msg="Processing page"`); n != 2 {
+			t.Errorf("Expected 2 pages logged at %s but got %d:\n%s", level, n, buf.String())
+		}
+		if detailed := strings.Contains(buf.String(), "duration="); detailed != (level == slog.LevelDebug) {
+			t.Errorf("Expected page timings only at debug level, got at %s:\n%s", level, buf.String())
+		}
+	}
+}
+
+func TestIterate(t *testing.T) {
+	q, err := New(newTestClient(t), WithIndex("logs"), WithBatchSize(2))
+	if err != nil {
+		t.Fatalf("Error creating querier: %s", err)
+	}
+
+	var titles []string
+	err = Iterate(context.Background(), q, func(doc client.Document[struct {
+		Title string `json:"title"`
+	}]) error {
+		titles = append(titles, doc.ID+":"+doc.Source.Title)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Error iterating: %s", err)
+	}
+	if strings.Join(titles, " ") != "1:a 2:b 3:c" {
+		t.Errorf("Expected 1:a 2:b 3:c but got %v", titles)
+	}
+}
+
+func TestNewRejectsInvalidOptions(t *testing.T) {
+	tests := []struct {
+		opts     []Option
+		expected string
+	}{
+		{nil, "an index is required"},
+		{[]Option{WithIndex("logs"), WithBatchSize(0)}, "batch size must be positive"},
+		{[]Option{WithIndex("logs"), WithWorkers(0)}, "workers must be positive"},
+		{[]Option{WithIndex("logs"), WithPagination("cursor")}, `unknown pagination mode "cursor"`},
+	}
+	for _, test := range tests {
+		_, err := New(nil, test.opts...)
+		if err == nil || !strings.Contains(err.Error(), test.expected) {
+			t.Errorf("Expected error %q but got %v", test.expected, err)
+		}
+	}
+}
+
+func TestExportTraces(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	// Tracers created before are bound to the first provider set, so it is
+	// not reset afterwards.
+	otel.SetTracerProvider(provider)
+
+	server := estest.New(t)
+	for i := 1; i <= 3; i++ {
+		server.Index("logs", estest.Doc{ID: fmt.Sprint(i), Source: map[string]interface{}{"n": i}})
+	}
+	server.Fail(estest.Search, 1, estest.Rejected)
+
+	q, err := New(server.Client(), WithIndex("logs"), WithBatchSize(2), WithSink(&recordingSink{}),
+		WithRetryPolicy(client.RetryPolicy{InitialInterval: time.Millisecond, MaxInterval: time.Millisecond, MaxElapsedTime: time.Second}))
+	if err != nil {
+		t.Fatalf("Error creating querier: %s", err)
+	}
+	if _, err := q.Export(context.Background()); err != nil {
+		t.Fatalf("Error exporting: %s", err)
+	}
+
+	spans := recorder.Ended()
+	var export sdktrace.ReadOnlySpan
+	for _, span := range spans {
+		if span.Name() == "Export" {
+			export = span
+		}
+	}
+	if export == nil {
+		t.Fatalf("Expected an Export span")
+	}
+
+	var names []string
+	for _, span := range spans {
+		if span == export {
+			continue
+		}
+		if span.Parent().SpanID() != export.SpanContext().SpanID() {
+			t.Errorf("Expected span %s to be a child of Export", span.Name())
+		}
+		names = append(names, span.Name())
+		if span.Name() == "InitialSearch" {
+			if events := span.Events(); len(events) != 1 || events[0].Name != "retry" {
+				t.Errorf("Expected one retry event on InitialSearch but got %v", events)
+			}
+		}
+	}
+	expected := "Sink.open InitialSearch Scroll Scroll ClearScroll Sink.close"
+	if strings.Join(names, " ") != expected {
+		t.Errorf("Expected spans %q but got %q", expected, strings.Join(names, " "))
+	}
+}
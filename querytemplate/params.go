@@ -0,0 +1,83 @@
+// querytemplate/params.go
+package querytemplate
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// EnvPrefix is prepended to the upper-cased parameter name to find its
+// environment variable, e.g. QUERY_PARAM_TITLE for "title".
+const EnvPrefix = "QUERY_PARAM_"
+
+// Values is a set of raw parameter values. It implements flag.Value so it
+// can collect repeated -param name=value flags.
+type Values map[string]string
+
+func (v Values) String() string {
+	pairs := make([]string, 0, len(v))
+	for name, value := range v {
+		pairs = append(pairs, name+"="+value)
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (v Values) Set(s string) error {
+	name, value, ok := strings.Cut(s, "=")
+	if !ok || strings.TrimSpace(name) == "" {
+		return fmt.Errorf("expected name=value, got %q", s)
+	}
+	v[strings.TrimSpace(name)] = value
+	return nil
+}
+
+// Merge returns the union of sets, later sets overriding earlier ones.
+func Merge(sets ...Values) Values {
+	merged := make(Values)
+	for _, set := range sets {
+		for name, value := range set {
+			merged[name] = value
+		}
+	}
+	return merged
+}
+
+// LoadFile reads parameter values from a JSON object. Strings are taken as
+// is; numbers, booleans, arrays and objects as their JSON text.
+func LoadFile(path string) (Values, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read params file: %w", err)
+	}
+
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("failed to parse params file %s: %w", path, err)
+	}
+
+	values := make(Values, len(raw))
+	for name, value := range raw {
+		var s string
+		if err := json.Unmarshal(value, &s); err == nil {
+			values[name] = s
+		} else {
+			values[name] = string(value)
+		}
+	}
+	return values, nil
+}
+
+// FromEnv returns the values of the template's parameters that are set in
+// the environment.
+func FromEnv(t *Template) Values {
+	values := make(Values)
+	for _, param := range t.Params() {
+		key := EnvPrefix + strings.ToUpper(strings.NewReplacer("-", "_", ".", "_").Replace(param.Name))
+		if value, ok := os.LookupEnv(key); ok {
+			values[param.Name] = value
+		}
+	}
+	return values
+}
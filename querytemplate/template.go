@@ -0,0 +1,335 @@
+// querytemplate/template.go
+package querytemplate
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Parameter types.
+const (
+	TypeString  = "string"
+	TypeInt     = "int"
+	TypeFloat   = "float"
+	TypeBool    = "bool"
+	TypeDate    = "date"
+	TypeStrings = "strings"
+	TypeInts    = "ints"
+	TypeJSON    = "json"
+)
+
+// Param is a parameter declared by a placeholder.
+type Param struct {
+	Name       string
+	Type       string
+	Default    string
+	HasDefault bool
+}
+
+// Required reports whether the parameter must be supplied.
+func (p Param) Required() bool {
+	return !p.HasDefault
+}
+
+// Template is a query file with {{...}} placeholders. A placeholder is
+//
+//	{{name}}  {{name:type}}  {{name=default}}  {{name:type=default}}
+//
+// where type is one of string (the default), int, float, bool, date,
+// strings, ints or json. A parameter without a default is required.
+//
+// Values are substituted as JSON. A placeholder that makes up a whole JSON
+// string, as in "size": "{{size:int}}", is replaced together with its quotes,
+// so typed values come out as numbers, booleans or arrays. A placeholder
+// inside a longer string is replaced by the escaped text of its value, and
+// one outside any string by the JSON value.
+type Template struct {
+	segments []segment
+	params   map[string]Param
+	order    []string
+}
+
+// segment is either literal text or a placeholder.
+type segment struct {
+	text string
+	name string
+	// inString and wholeString describe where the placeholder sits in the
+	// surrounding JSON.
+	inString    bool
+	wholeString bool
+}
+
+// Parse parses a template. It fails on unterminated or malformed
+// placeholders and on parameters declared twice with different types.
+func Parse(src string) (*Template, error) {
+	t := &Template{params: make(map[string]Param)}
+
+	inString := false
+	literal := strings.Builder{}
+	for i := 0; i < len(src); {
+		if strings.HasPrefix(src[i:], "{{") {
+			end := strings.Index(src[i+2:], "}}")
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated placeholder at offset %d", i)
+			}
+			param, err := parsePlaceholder(src[i+2 : i+2+end])
+			if err != nil {
+				return nil, fmt.Errorf("placeholder at offset %d: %w", i, err)
+			}
+			if err := t.declare(param); err != nil {
+				return nil, err
+			}
+
+			seg := segment{name: param.Name, inString: inString}
+			next := i + 2 + end + 2
+			text := literal.String()
+			if inString && strings.HasSuffix(text, `"`) && !isEscaped(text, len(text)-1) &&
+				next < len(src) && src[next] == '"' {
+				// The placeholder is the entire string literal: drop the
+				// quotes on both sides.
+				text = text[:len(text)-1]
+				seg.wholeString = true
+				next++
+				inString = false
+			}
+			if text != "" {
+				t.segments = append(t.segments, segment{text: text})
+			}
+			literal.Reset()
+			t.segments = append(t.segments, seg)
+			i = next
+			continue
+		}
+
+		c := src[i]
+		if c == '"' && !isEscaped(src, i) {
+			inString = !inString
+		}
+		literal.WriteByte(c)
+		i++
+	}
+	if literal.Len() > 0 {
+		t.segments = append(t.segments, segment{text: literal.String()})
+	}
+	return t, nil
+}
+
+// isEscaped reports whether s[i] is preceded by an odd number of backslashes.
+func isEscaped(s string, i int) bool {
+	n := 0
+	for j := i - 1; j >= 0 && s[j] == '\\'; j-- {
+		n++
+	}
+	return n%2 == 1
+}
+
+func parsePlaceholder(body string) (Param, error) {
+	param := Param{Type: TypeString}
+	spec := strings.TrimSpace(body)
+	if eq := strings.Index(spec, "="); eq >= 0 {
+		param.Default = spec[eq+1:]
+		param.HasDefault = true
+		spec = strings.TrimSpace(spec[:eq])
+	}
+	if colon := strings.Index(spec, ":"); colon >= 0 {
+		param.Type = strings.TrimSpace(spec[colon+1:])
+		spec = strings.TrimSpace(spec[:colon])
+	}
+	param.Name = spec
+
+	if param.Name == "" {
+		return param, fmt.Errorf("missing parameter name")
+	}
+	for _, r := range param.Name {
+		if !(r == '_' || r == '-' || r == '.' || r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z') {
+			return param, fmt.Errorf("invalid parameter name %q", param.Name)
+		}
+	}
+	switch param.Type {
+	case TypeString, TypeInt, TypeFloat, TypeBool, TypeDate, TypeStrings, TypeInts, TypeJSON:
+	default:
+		return param, fmt.Errorf("parameter %q has unknown type %q", param.Name, param.Type)
+	}
+	return param, nil
+}
+
+func (t *Template) declare(param Param) error {
+	existing, ok := t.params[param.Name]
+	if !ok {
+		t.params[param.Name] = param
+		t.order = append(t.order, param.Name)
+		return nil
+	}
+	if existing.Type != param.Type {
+		return fmt.Errorf("parameter %q declared as both %s and %s", param.Name, existing.Type, param.Type)
+	}
+	if param.HasDefault {
+		if existing.HasDefault && existing.Default != param.Default {
+			return fmt.Errorf("parameter %q has conflicting defaults %q and %q", param.Name, existing.Default, param.Default)
+		}
+		t.params[param.Name] = param
+	}
+	return nil
+}
+
+// Params returns the declared parameters in order of first appearance.
+func (t *Template) Params() []Param {
+	params := make([]Param, len(t.order))
+	for i, name := range t.order {
+		params[i] = t.params[name]
+	}
+	return params
+}
+
+// Render substitutes values, falling back to defaults, and returns the
+// query. Relative dates are resolved against now. Every missing required
+// parameter and every value that does not parse as its type is reported.
+// Values for parameters the template does not declare are rejected, since
+// they are usually typos.
+func (t *Template) Render(values map[string]string, now time.Time) (string, error) {
+	var problems []string
+
+	var unknown []string
+	for name := range values {
+		if _, ok := t.params[name]; !ok {
+			unknown = append(unknown, name)
+		}
+	}
+	sort.Strings(unknown)
+	for _, name := range unknown {
+		problems = append(problems, fmt.Sprintf("unknown parameter %q", name))
+	}
+
+	resolved := make(map[string]interface{}, len(t.params))
+	for _, name := range t.order {
+		param := t.params[name]
+		raw, ok := values[name]
+		if !ok {
+			if !param.HasDefault {
+				problems = append(problems, fmt.Sprintf("missing required parameter %q (%s)", name, param.Type))
+				continue
+			}
+			raw = param.Default
+		}
+		value, err := convert(param.Type, raw, now)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("parameter %q: %v", name, err))
+			continue
+		}
+		resolved[name] = value
+	}
+	if len(problems) > 0 {
+		return "", fmt.Errorf("invalid query parameters: %s", strings.Join(problems, "; "))
+	}
+
+	var out strings.Builder
+	for _, seg := range t.segments {
+		if seg.name == "" {
+			out.WriteString(seg.text)
+			continue
+		}
+		encoded, err := json.Marshal(resolved[seg.name])
+		if err != nil {
+			return "", fmt.Errorf("parameter %q: %w", seg.name, err)
+		}
+		if seg.inString && !seg.wholeString {
+			out.WriteString(stringContent(resolved[seg.name], encoded))
+		} else {
+			out.Write(encoded)
+		}
+	}
+
+	query := out.String()
+	if !json.Valid([]byte(query)) {
+		return "", fmt.Errorf("rendered query is not valid JSON")
+	}
+	return query, nil
+}
+
+// stringContent renders v for insertion inside an existing JSON string.
+func stringContent(v interface{}, encoded []byte) string {
+	s, ok := v.(string)
+	if !ok {
+		// Numbers, booleans and arrays are inserted as their JSON text,
+		// escaped so they stay inside the string.
+		s = string(encoded)
+	}
+	quoted, _ := json.Marshal(s)
+	return string(quoted[1 : len(quoted)-1])
+}
+
+func convert(typ, raw string, now time.Time) (interface{}, error) {
+	switch typ {
+	case TypeString:
+		return raw, nil
+	case TypeInt:
+		n, err := strconv.ParseInt(strings.TrimSpace(raw), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not an int", raw)
+		}
+		return n, nil
+	case TypeFloat:
+		f, err := strconv.ParseFloat(strings.TrimSpace(raw), 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a float", raw)
+		}
+		return f, nil
+	case TypeBool:
+		b, err := strconv.ParseBool(strings.TrimSpace(raw))
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a bool", raw)
+		}
+		return b, nil
+	case TypeDate:
+		t, err := ParseTime(raw, now)
+		if err != nil {
+			return nil, err
+		}
+		return t.UTC().Format(time.RFC3339Nano), nil
+	case TypeStrings:
+		return parseList(raw, func(s string) (interface{}, error) { return s, nil })
+	case TypeInts:
+		return parseList(raw, func(s string) (interface{}, error) {
+			return convert(TypeInt, s, now)
+		})
+	case TypeJSON:
+		if !json.Valid([]byte(raw)) {
+			return nil, fmt.Errorf("%q is not valid JSON", raw)
+		}
+		return json.RawMessage(raw), nil
+	}
+	return nil, fmt.Errorf("unknown type %q", typ)
+}
+
+// parseList accepts either a JSON array or a comma-separated list.
+func parseList(raw string, elem func(string) (interface{}, error)) ([]interface{}, error) {
+	raw = strings.TrimSpace(raw)
+	var items []string
+	if strings.HasPrefix(raw, "[") {
+		var decoded []interface{}
+		if err := json.Unmarshal([]byte(raw), &decoded); err != nil {
+			return nil, fmt.Errorf("%q is not a valid list", raw)
+		}
+		for _, d := range decoded {
+			items = append(items, fmt.Sprint(d))
+		}
+	} else if raw != "" {
+		for _, item := range strings.Split(raw, ",") {
+			items = append(items, strings.TrimSpace(item))
+		}
+	}
+
+	list := make([]interface{}, 0, len(items))
+	for _, item := range items {
+		v, err := elem(item)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, v)
+	}
+	return list, nil
+}
@@ -0,0 +1,86 @@
+package querytemplate
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+var testNow = time.Date(2024, 5, 1, 12, 34, 56, 0, time.UTC)
+
+func TestRenderTypedValues(t *testing.T) {
+	tmpl, err := Parse(`{
+		"size": "{{size:int=10}}",
+		"query": {"bool": {"filter": [
+			{"match_phrase": {"title": "{{title}}"}},
+			{"terms": {"tags": "{{tags:strings}}"}},
+			{"range": {"@timestamp": {"gte": "{{from:date=now-15m}}"}}},
+			{"query_string": {"query": "title:{{title}}"}}
+		]}}
+	}`)
+	if err != nil {
+		t.Fatalf("Error parsing template: %s", err)
+	}
+
+	query, err := tmpl.Render(Values{
+		"title": `Say "hi" \ bye`,
+		"tags":  "a, b",
+	}, testNow)
+	if err != nil {
+		t.Fatalf("Error rendering template: %s", err)
+	}
+
+	for _, expected := range []string{
+		`"size": 10`,
+		`"title": "Say \"hi\" \\ bye"`,
+		`"tags": ["a","b"]`,
+		`"gte": "2024-05-01T12:19:56Z"`,
+		`"query": "title:Say \"hi\" \\ bye"`,
+	} {
+		if !strings.Contains(query, expected) {
+			t.Errorf("Expected query to contain %s but got %s", expected, query)
+		}
+	}
+}
+
+func TestRenderReportsMissingAndInvalidParams(t *testing.T) {
+	tmpl, err := Parse(`{"size": {{size:int}}, "q": "{{q}}", "f": "{{flag:bool=false}}"}`)
+	if err != nil {
+		t.Fatalf("Error parsing template: %s", err)
+	}
+
+	_, err = tmpl.Render(Values{"size": "ten", "typo": "x"}, testNow)
+	if err == nil {
+		t.Fatalf("Expected an error")
+	}
+	for _, expected := range []string{`unknown parameter "typo"`, `missing required parameter "q"`, `"ten" is not an int`} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("Expected error to mention %s but got %s", expected, err)
+		}
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	tests := map[string]string{
+		"now":        "2024-05-01T12:34:56Z",
+		"now-15m":    "2024-05-01T12:19:56Z",
+		"now+1h":     "2024-05-01T13:34:56Z",
+		"now-7d/d":   "2024-04-24T00:00:00Z",
+		"now/w":      "2024-04-29T00:00:00Z",
+		"2024-01-02": "2024-01-02T00:00:00Z",
+	}
+	for input, expected := range tests {
+		got, err := ParseTime(input, testNow)
+		if err != nil {
+			t.Errorf("Error parsing %q: %s", input, err)
+			continue
+		}
+		if got.Format(time.RFC3339) != expected {
+			t.Errorf("Expected %q to be %s but got %s", input, expected, got.Format(time.RFC3339))
+		}
+	}
+
+	if _, err := ParseTime("now-15x", testNow); err == nil {
+		t.Errorf("Expected an error for an unknown unit")
+	}
+}
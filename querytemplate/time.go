@@ -0,0 +1,93 @@
+// querytemplate/time.go
+package querytemplate
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var timeUnits = map[byte]time.Duration{
+	's': time.Second,
+	'm': time.Minute,
+	'h': time.Hour,
+	'd': 24 * time.Hour,
+	'w': 7 * 24 * time.Hour,
+}
+
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02",
+}
+
+// ParseTime parses an absolute time (RFC 3339 or YYYY-MM-DD, read as UTC)
+// or a time relative to now in a subset of Elasticsearch date math:
+//
+//	now  now-15m  now+1h  now-7d/d  now/h-30m
+//
+// Supported units are s, m, h, d and w. A "/unit" suffix rounds down to
+// the start of that unit in UTC.
+func ParseTime(s string, now time.Time) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, "now") {
+		for _, layout := range timeLayouts {
+			if t, err := time.Parse(layout, s); err == nil {
+				return t, nil
+			}
+		}
+		return time.Time{}, fmt.Errorf("%q is not a date; use RFC 3339, YYYY-MM-DD or now[+-N unit]", s)
+	}
+
+	t := now.UTC()
+	expr := s[len("now"):]
+	for expr != "" {
+		op := expr[0]
+		expr = expr[1:]
+
+		switch op {
+		case '+', '-':
+			i := 0
+			for i < len(expr) && expr[i] >= '0' && expr[i] <= '9' {
+				i++
+			}
+			if i == 0 || i == len(expr) {
+				return time.Time{}, fmt.Errorf("%q: expected a number and a unit after %c", s, op)
+			}
+			n, err := strconv.Atoi(expr[:i])
+			if err != nil {
+				return time.Time{}, fmt.Errorf("%q: %w", s, err)
+			}
+			unit, ok := timeUnits[expr[i]]
+			if !ok {
+				return time.Time{}, fmt.Errorf("%q: unknown unit %q", s, expr[i])
+			}
+			d := time.Duration(n) * unit
+			if op == '-' {
+				d = -d
+			}
+			t = t.Add(d)
+			expr = expr[i+1:]
+		case '/':
+			if expr == "" {
+				return time.Time{}, fmt.Errorf("%q: expected a unit after /", s)
+			}
+			switch expr[0] {
+			case 'w':
+				t = t.Truncate(24 * time.Hour)
+				t = t.AddDate(0, 0, -((int(t.Weekday()) + 6) % 7))
+			default:
+				unit, ok := timeUnits[expr[0]]
+				if !ok {
+					return time.Time{}, fmt.Errorf("%q: unknown unit %q", s, expr[0])
+				}
+				t = t.Truncate(unit)
+			}
+			expr = expr[1:]
+		default:
+			return time.Time{}, fmt.Errorf("%q: unexpected %q", s, op)
+		}
+	}
+	return t, nil
+}
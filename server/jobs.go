@@ -0,0 +1,500 @@
+// server/jobs.go
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v8"
+
+	"github.com/terenzio/ElasticSearchQuerier/client"
+	"github.com/terenzio/ElasticSearchQuerier/config"
+	"github.com/terenzio/ElasticSearchQuerier/processor"
+	"github.com/terenzio/ElasticSearchQuerier/querier"
+	"github.com/terenzio/ElasticSearchQuerier/querytemplate"
+)
+
+// Job states.
+const (
+	StatusQueued    = "queued"
+	StatusRunning   = "running"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+	StatusCancelled = "cancelled"
+)
+
+var (
+	// ErrNotFound is returned for an unknown job ID.
+	ErrNotFound = errors.New("job not found")
+	// ErrQueueFull is returned by Submit when every worker is busy and the
+	// queue holds as many jobs as it may.
+	ErrQueueFull = errors.New("too many jobs waiting, try again later")
+	// ErrShuttingDown is returned by Submit once Stop was called.
+	ErrShuttingDown = errors.New("server is shutting down")
+	// ErrFinished is returned by Cancel for a job that has already ended.
+	ErrFinished = errors.New("job has already finished")
+)
+
+// pruneInterval is how often the Manager looks for finished jobs older than
+// the retention.
+const pruneInterval = time.Minute
+
+// Request describes an export job.
+type Request struct {
+	// Index is the index, alias or pattern to search. It is required.
+	Index string `json:"index"`
+	// Query is the search body, given as a JSON object or as a string
+	// holding a query template; see querytemplate.Template. It defaults to
+	// querier.DefaultQuery.
+	Query json.RawMessage `json:"query,omitempty"`
+	// Params are the values of the template's parameters.
+	Params map[string]string `json:"params,omitempty"`
+	// Format is the sink writing the result, such as "jsonl", "csv" or
+	// "parquet". It defaults to "jsonl".
+	Format string `json:"format,omitempty"`
+	// Columns are the columns of the csv and tsv formats. They default to
+	// the leaf fields of the first document.
+	Columns []string `json:"columns,omitempty"`
+}
+
+// Job is the state of a job as reported by the API.
+type Job struct {
+	ID     string `json:"id"`
+	Status string `json:"status"`
+	Index  string `json:"index"`
+	Format string `json:"format"`
+	// Error is why the job failed or was cancelled.
+	Error string `json:"error,omitempty"`
+	// Documents, Pages and Malformed count what has been written so far.
+	// TotalPages is the number of pages the search is expected to take,
+	// known once its first page has arrived.
+	Documents  int        `json:"documents"`
+	Pages      int        `json:"pages"`
+	TotalPages int        `json:"total_pages"`
+	Malformed  int        `json:"malformed"`
+	Created    time.Time  `json:"created"`
+	Started    *time.Time `json:"started,omitempty"`
+	Finished   *time.Time `json:"finished,omitempty"`
+}
+
+// job is a Job along with what the Manager needs to run and cancel it.
+type job struct {
+	Job
+	query  string
+	sink   processor.Sink
+	path   string
+	ctx    context.Context
+	cancel context.CancelFunc
+	// querier is set while the job runs.
+	querier *querier.Querier
+	// totals holds the expected pages of each slice.
+	totals map[int]int
+}
+
+// Manager runs export jobs on a fixed number of workers, holding the jobs
+// submitted while every worker is busy in a bounded queue. Finished jobs
+// and their results are kept for cfg.JobRetention, and at most
+// cfg.JobHistory of them; they do not survive a restart.
+type Manager struct {
+	es     *elasticsearch.Client
+	cfg    *config.Config
+	queue  chan *job
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu      sync.Mutex
+	jobs    map[string]*job
+	stopped bool
+}
+
+// NewManager returns a Manager searching with es and writing results to
+// cfg.JobsDir, which it creates. Jobs are run by cfg.JobWorkers workers with
+// up to cfg.JobQueue waiting, using the batch size, keep-alive, pagination,
+// workers and sink settings of cfg. The workers start at once; cancelling
+// ctx aborts every job.
+func NewManager(ctx context.Context, es *elasticsearch.Client, cfg *config.Config) (*Manager, error) {
+	if err := os.MkdirAll(cfg.JobsDir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create jobs directory: %w", err)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	m := &Manager{
+		es:     es,
+		cfg:    cfg,
+		queue:  make(chan *job, cfg.JobQueue),
+		ctx:    ctx,
+		cancel: cancel,
+		jobs:   make(map[string]*job),
+	}
+	for i := 0; i < cfg.JobWorkers; i++ {
+		m.wg.Add(1)
+		go m.work()
+	}
+	go m.pruneEvery(pruneInterval)
+	return m, nil
+}
+
+// Submit validates req and queues it, returning the new job.
+func (m *Manager) Submit(req Request) (Job, error) {
+	if req.Index == "" {
+		return Job{}, errors.New("an index is required")
+	}
+	if req.Format == "" {
+		req.Format = "jsonl"
+	}
+	if req.Format == "stdout" {
+		return Job{}, errors.New("format stdout cannot be downloaded")
+	}
+	query, err := renderQuery(req.Query, req.Params)
+	if err != nil {
+		return Job{}, err
+	}
+	id, err := newID()
+	if err != nil {
+		return Job{}, err
+	}
+
+	j := &job{
+		Job: Job{
+			ID:      id,
+			Status:  StatusQueued,
+			Index:   req.Index,
+			Format:  req.Format,
+			Created: time.Now().UTC(),
+		},
+		query:  query,
+		path:   filepath.Join(m.cfg.JobsDir, id+extension(req.Format)),
+		totals: make(map[int]int),
+	}
+	j.ctx, j.cancel = context.WithCancel(m.ctx)
+	sink, err := processor.New(req.Format, processor.Options{
+		Path:           j.path,
+		Metadata:       m.cfg.SinkMetadata,
+		Columns:        req.Columns,
+		ArrayMode:      m.cfg.ArrayMode,
+		ArraySeparator: m.cfg.ArraySeparator,
+		Mapping: func() (map[string]interface{}, error) {
+			return client.GetMapping(j.ctx, m.es, m.cfg.RetryPolicy(), req.Index)
+		},
+		RowGroupRows: m.cfg.RowGroupRows,
+	})
+	if err != nil {
+		j.cancel()
+		return Job{}, fmt.Errorf("failed to create sink: %w", err)
+	}
+	j.sink = sink
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.stopped {
+		j.cancel()
+		return Job{}, ErrShuttingDown
+	}
+	select {
+	case m.queue <- j:
+	default:
+		j.cancel()
+		return Job{}, ErrQueueFull
+	}
+	m.jobs[id] = j
+	slog.Info("Job queued", "job", id, "index", req.Index, "format", req.Format)
+	return j.Job, nil
+}
+
+// renderQuery fills in the parameters of a query template given as a JSON
+// string, or returns a query given as an object as it is.
+func renderQuery(raw json.RawMessage, params map[string]string) (string, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return querier.DefaultQuery, nil
+	}
+	src := string(raw)
+	var text string
+	if err := json.Unmarshal(raw, &text); err == nil {
+		src = text
+	}
+	tmpl, err := querytemplate.Parse(src)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse query template: %w", err)
+	}
+	return tmpl.Render(params, time.Now())
+}
+
+func newID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate job ID: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// extension returns the file extension of the results of format.
+func extension(format string) string {
+	switch format {
+	case "file":
+		return ".txt"
+	case "bulk":
+		return ".ndjson"
+	case "jsonl", "csv", "tsv", "parquet":
+		return "." + format
+	}
+	return ".out"
+}
+
+// Get returns the job with the given ID.
+func (m *Manager) Get(id string) (Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	j, ok := m.jobs[id]
+	if !ok {
+		return Job{}, ErrNotFound
+	}
+	return j.Job, nil
+}
+
+// List returns every job, most recently submitted first.
+func (m *Manager) List() []Job {
+	m.mu.Lock()
+	jobs := make([]Job, 0, len(m.jobs))
+	for _, j := range m.jobs {
+		jobs = append(jobs, j.Job)
+	}
+	m.mu.Unlock()
+
+	sort.Slice(jobs, func(a, b int) bool {
+		if !jobs[a].Created.Equal(jobs[b].Created) {
+			return jobs[a].Created.After(jobs[b].Created)
+		}
+		return jobs[a].ID < jobs[b].ID
+	})
+	return jobs
+}
+
+// Cancel aborts a queued or running job. A running job releases its search
+// context and its partial result is deleted.
+func (m *Manager) Cancel(id string) (Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	j, ok := m.jobs[id]
+	if !ok {
+		return Job{}, ErrNotFound
+	}
+	switch j.Status {
+	case StatusQueued:
+		// The worker picking it up will skip it
+		m.finish(j, StatusCancelled, "cancelled")
+	case StatusRunning:
+		// The worker running it records the outcome
+		j.Error = "cancelled"
+	default:
+		return j.Job, ErrFinished
+	}
+	j.cancel()
+	return j.Job, nil
+}
+
+// Result returns the path of the result of a job that succeeded.
+func (m *Manager) Result(id string) (Job, string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	j, ok := m.jobs[id]
+	if !ok {
+		return Job{}, "", ErrNotFound
+	}
+	if j.Status != StatusSucceeded {
+		return j.Job, "", fmt.Errorf("job is %s, not %s", j.Status, StatusSucceeded)
+	}
+	return j.Job, j.path, nil
+}
+
+// Stop turns new submissions away, cancels the queued jobs and makes the
+// running ones stop after the page in hand. Wait returns once they have.
+func (m *Manager) Stop() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.stopped {
+		return
+	}
+	m.stopped = true
+	close(m.queue)
+	for _, j := range m.jobs {
+		switch j.Status {
+		case StatusQueued:
+			m.finish(j, StatusCancelled, ErrShuttingDown.Error())
+			j.cancel()
+		case StatusRunning:
+			j.querier.Stop()
+		}
+	}
+}
+
+// Abort cancels every job at once.
+func (m *Manager) Abort() {
+	m.cancel()
+}
+
+// Wait blocks until the workers have exited after Stop.
+func (m *Manager) Wait() {
+	m.wg.Wait()
+	m.cancel()
+}
+
+func (m *Manager) work() {
+	defer m.wg.Done()
+	for j := range m.queue {
+		m.run(j)
+	}
+}
+
+// run runs a job unless it was cancelled while queued.
+func (m *Manager) run(j *job) {
+	m.mu.Lock()
+	if j.Status != StatusQueued {
+		m.mu.Unlock()
+		return
+	}
+	q, err := querier.New(m.es,
+		querier.WithIndex(j.Index),
+		querier.WithQuery(j.query),
+		querier.WithBatchSize(m.cfg.BatchSize),
+		querier.WithKeepAlive(m.cfg.ScrollDuration),
+		querier.WithPagination(m.cfg.PaginationMode),
+		querier.WithWorkers(m.cfg.Workers),
+		querier.WithStreaming(m.cfg.Stream),
+		querier.WithSink(j.sink),
+		querier.WithProgress(&progress{m: m, j: j}),
+		querier.WithLogger(slog.Default().With("job", j.ID)),
+		querier.WithRetryPolicy(m.cfg.RetryPolicy()),
+	)
+	if err != nil {
+		m.finish(j, StatusFailed, err.Error())
+		m.mu.Unlock()
+		return
+	}
+	started := time.Now().UTC()
+	j.Status = StatusRunning
+	j.Started = &started
+	j.querier = q
+	m.mu.Unlock()
+
+	slog.Info("Job started", "job", j.ID, "index", j.Index)
+	_, err = q.Export(j.ctx)
+	j.cancel()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	switch {
+	case err == nil:
+		m.finish(j, StatusSucceeded, "")
+	case j.Error != "":
+		// Cancelled through the API
+		m.finish(j, StatusCancelled, j.Error)
+	case errors.Is(err, querier.ErrStopped) || errors.Is(err, context.Canceled):
+		m.finish(j, StatusCancelled, ErrShuttingDown.Error())
+	default:
+		m.finish(j, StatusFailed, err.Error())
+	}
+}
+
+// finish records the end of a job, deleting the result unless it
+// succeeded, and prunes the jobs finished before. m.mu must be held.
+func (m *Manager) finish(j *job, status, reason string) {
+	finished := time.Now().UTC()
+	j.Status = status
+	j.Error = reason
+	j.Finished = &finished
+	j.querier = nil
+	if status != StatusSucceeded {
+		removeResult(j)
+	}
+
+	args := []any{"job", j.ID, "index", j.Index, "status", status, "docs", j.Documents}
+	if j.Started != nil {
+		args = append(args, "duration", finished.Sub(*j.Started))
+	}
+	if reason != "" {
+		args = append(args, "error", reason)
+	}
+	slog.Info("Job finished", args...)
+	m.prune(finished)
+}
+
+// pruneEvery prunes the finished jobs every interval until the Manager's
+// context is cancelled.
+func (m *Manager) pruneEvery(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.ctx.Done():
+			return
+		case now := <-ticker.C:
+			m.mu.Lock()
+			m.prune(now.UTC())
+			m.mu.Unlock()
+		}
+	}
+}
+
+// prune forgets the jobs that finished more than cfg.JobRetention before
+// now, and the oldest beyond the cfg.JobHistory most recent, deleting their
+// results. m.mu must be held.
+func (m *Manager) prune(now time.Time) {
+	var finished []*job
+	for _, j := range m.jobs {
+		if j.Finished != nil {
+			finished = append(finished, j)
+		}
+	}
+	sort.Slice(finished, func(a, b int) bool {
+		return finished[a].Finished.After(*finished[b].Finished)
+	})
+	for i, j := range finished {
+		expired := m.cfg.JobRetention > 0 && now.Sub(*j.Finished) > m.cfg.JobRetention
+		if i < m.cfg.JobHistory && !expired {
+			continue
+		}
+		delete(m.jobs, j.ID)
+		removeResult(j)
+		slog.Debug("Job pruned", "job", j.ID)
+	}
+}
+
+// removeResult deletes the result file of a job, if it has one.
+func removeResult(j *job) {
+	if err := os.Remove(j.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		slog.Warn("Failed to delete job result", "job", j.ID, "error", err)
+	}
+}
+
+// progress updates the counts of a job as its pages are written.
+type progress struct {
+	m *Manager
+	j *job
+}
+
+func (p *progress) Written(page *client.Page) error {
+	p.m.mu.Lock()
+	defer p.m.mu.Unlock()
+	p.j.Documents += len(page.Hits) + page.Streamed
+	p.j.Malformed += len(page.Malformed)
+	p.j.Pages++
+	if _, ok := p.j.totals[page.Slice]; !ok {
+		p.j.totals[page.Slice] = page.TotalPages
+		p.j.TotalPages += page.TotalPages
+	}
+	return nil
+}
+
+func (p *progress) Stopped() error {
+	return nil
+}
@@ -0,0 +1,168 @@
+// server/server.go
+
+// Package server runs exports as jobs behind a REST API:
+//
+//	POST   /jobs              submit a Request, answered with the queued Job
+//	GET    /jobs              list the jobs, most recent first
+//	GET    /jobs/{id}         poll a job's status and progress
+//	POST   /jobs/{id}/cancel  cancel a queued or running job
+//	GET    /jobs/{id}/result  download the result of a job that succeeded
+//	GET    /healthz           report that the server is up
+//	GET    /metrics           the Prometheus metrics of the metrics package
+//
+// Errors are answered as {"error": "..."} with a 4xx or 5xx status. Given a
+// token, every endpoint but /healthz requires it as a bearer token.
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/terenzio/ElasticSearchQuerier/logging"
+	"github.com/terenzio/ElasticSearchQuerier/metrics"
+)
+
+// maxRequestSize bounds the body of a submission.
+const maxRequestSize = 1 << 20
+
+// NewHandler returns the REST API of m. If token is not empty, requests
+// other than health checks must carry it in an "Authorization: Bearer"
+// header.
+func NewHandler(m *Manager, token string) http.Handler {
+	h := &handler{m: m}
+	api := http.NewServeMux()
+	api.HandleFunc("POST /jobs", h.submit)
+	api.HandleFunc("GET /jobs", h.list)
+	api.HandleFunc("GET /jobs/{id}", h.get)
+	api.HandleFunc("POST /jobs/{id}/cancel", h.cancel)
+	api.HandleFunc("GET /jobs/{id}/result", h.result)
+	api.Handle("GET /metrics", metrics.Handler())
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	})
+	mux.Handle("/", requireToken(token, api))
+	return mux
+}
+
+// requireToken answers 401 to requests that do not carry token as a bearer
+// token, unless token is empty.
+func requireToken(token string, next http.Handler) http.Handler {
+	if token == "" {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="jobs"`)
+			writeError(w, http.StatusUnauthorized, errors.New("a valid bearer token is required"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+type handler struct {
+	m *Manager
+}
+
+func (h *handler) submit(w http.ResponseWriter, r *http.Request) {
+	var req Request
+	dec := json.NewDecoder(io.LimitReader(r.Body, maxRequestSize))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("malformed job request: %w", err))
+		return
+	}
+
+	job, err := h.m.Submit(req)
+	switch {
+	case errors.Is(err, ErrQueueFull), errors.Is(err, ErrShuttingDown):
+		w.Header().Set("Retry-After", "30")
+		writeError(w, http.StatusServiceUnavailable, err)
+	case err != nil:
+		writeError(w, http.StatusBadRequest, err)
+	default:
+		w.Header().Set("Location", "/jobs/"+job.ID)
+		writeJSON(w, http.StatusAccepted, job)
+	}
+}
+
+func (h *handler) list(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string][]Job{"jobs": h.m.List()})
+}
+
+func (h *handler) get(w http.ResponseWriter, r *http.Request) {
+	job, err := h.m.Get(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, job)
+}
+
+func (h *handler) cancel(w http.ResponseWriter, r *http.Request) {
+	job, err := h.m.Cancel(r.PathValue("id"))
+	switch {
+	case errors.Is(err, ErrNotFound):
+		writeError(w, http.StatusNotFound, err)
+	case errors.Is(err, ErrFinished):
+		writeError(w, http.StatusConflict, err)
+	default:
+		writeJSON(w, http.StatusAccepted, job)
+	}
+}
+
+func (h *handler) result(w http.ResponseWriter, r *http.Request) {
+	job, path, err := h.m.Result(r.PathValue("id"))
+	switch {
+	case errors.Is(err, ErrNotFound):
+		writeError(w, http.StatusNotFound, err)
+		return
+	case err != nil:
+		writeError(w, http.StatusConflict, err)
+		return
+	}
+
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		// Pruned since
+		writeError(w, http.StatusNotFound, ErrNotFound)
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("failed to open result: %w", err))
+		return
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("failed to open result: %w", err))
+		return
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", job.ID+filepath.Ext(path)))
+	http.ServeContent(w, r, path, info.ModTime(), file)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Warn("Failed to write response", "error", err)
+	}
+}
+
+// writeError answers with err, redacted as it would be logged, since it may
+// come from Elasticsearch.
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": logging.Redact(err.Error())})
+}
@@ -0,0 +1,262 @@
+// server/server_test.go
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/terenzio/ElasticSearchQuerier/config"
+	"github.com/terenzio/ElasticSearchQuerier/estest"
+)
+
+// newTestManager returns a manager with one worker and room for one queued
+// job, searching an Elasticsearch holding documents with "n" from 1 to 5.
+// configure, if not nil, adjusts its configuration.
+func newTestManager(t *testing.T, configure func(cfg *config.Config)) (*Manager, *estest.Server) {
+	es := estest.New(t)
+	for i := 1; i <= 5; i++ {
+		es.Index("logs", estest.Doc{ID: fmt.Sprint(i), Source: map[string]interface{}{"n": i}})
+	}
+
+	cfg := config.Default()
+	cfg.JobsDir = t.TempDir()
+	cfg.JobWorkers = 1
+	cfg.JobQueue = 1
+	cfg.BatchSize = 2
+	cfg.PaginationMode = "pit"
+	if configure != nil {
+		configure(cfg)
+	}
+	manager, err := NewManager(context.Background(), es.Client(), cfg)
+	if err != nil {
+		t.Fatalf("Error creating manager: %s", err)
+	}
+	t.Cleanup(func() {
+		manager.Abort()
+		manager.Stop()
+		manager.Wait()
+	})
+	return manager, es
+}
+
+// newTestServer returns the jobs API, without a token, of a manager from
+// newTestManager.
+func newTestServer(t *testing.T) (*httptest.Server, *estest.Server) {
+	manager, es := newTestManager(t, nil)
+	api := httptest.NewServer(NewHandler(manager, ""))
+	t.Cleanup(api.Close)
+	return api, es
+}
+
+// call sends a request to the API and decodes its JSON answer into v.
+func call(t *testing.T, api *httptest.Server, method, path, body string, v interface{}) int {
+	req, err := http.NewRequest(method, api.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("Error creating request: %s", err)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Error calling %s %s: %s", method, path, err)
+	}
+	defer res.Body.Close()
+	if v != nil {
+		if err := json.NewDecoder(res.Body).Decode(v); err != nil {
+			t.Fatalf("Error decoding answer to %s %s: %s", method, path, err)
+		}
+	}
+	return res.StatusCode
+}
+
+// waitFor polls a job until it has ended.
+func waitFor(t *testing.T, api *httptest.Server, id string) Job {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		var job Job
+		if code := call(t, api, http.MethodGet, "/jobs/"+id, "", &job); code != http.StatusOK {
+			t.Fatalf("Expected status %d polling job but got %d", http.StatusOK, code)
+		}
+		if job.Status != StatusQueued && job.Status != StatusRunning {
+			return job
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Job %s still %s", id, job.Status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestJobExportsAndServesResult(t *testing.T) {
+	api, es := newTestServer(t)
+
+	var job Job
+	body := `{"index":"logs","query":"{\"query\":{\"range\":{\"n\":{\"gte\":\"{{from:int}}\"}}},\"sort\":[{\"n\":\"asc\"}]}",` +
+		`"params":{"from":"2"},"format":"csv","columns":["_id","n"]}`
+	if code := call(t, api, http.MethodPost, "/jobs", body, &job); code != http.StatusAccepted {
+		t.Fatalf("Expected status %d but got %d", http.StatusAccepted, code)
+	}
+	if job.Status != StatusQueued || job.Format != "csv" {
+		t.Errorf("Expected a queued csv job but got %+v", job)
+	}
+
+	job = waitFor(t, api, job.ID)
+	if job.Status != StatusSucceeded {
+		t.Fatalf("Expected the job to succeed but got %+v", job)
+	}
+	if job.Documents != 4 || job.Pages != 2 || job.TotalPages != 2 {
+		t.Errorf("Expected 4 documents in 2 of 2 pages but got %+v", job)
+	}
+
+	res, err := http.Get(api.URL + "/jobs/" + job.ID + "/result")
+	if err != nil {
+		t.Fatalf("Error downloading result: %s", err)
+	}
+	defer res.Body.Close()
+	result, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatalf("Error reading result: %s", err)
+	}
+	if expected := "_id,n\n2,2\n3,3\n4,4\n5,5\n"; string(result) != expected {
+		t.Errorf("Expected result %q but got %q", expected, result)
+	}
+	if disposition := res.Header.Get("Content-Disposition"); !strings.Contains(disposition, job.ID+".csv") {
+		t.Errorf("Expected the result to be named after the job but got %q", disposition)
+	}
+
+	var list struct{ Jobs []Job }
+	call(t, api, http.MethodGet, "/jobs", "", &list)
+	if len(list.Jobs) != 1 || list.Jobs[0].ID != job.ID {
+		t.Errorf("Expected the job to be listed but got %+v", list.Jobs)
+	}
+	if n := es.OpenContexts(); n != 0 {
+		t.Errorf("Expected every point in time to be closed but %d are open", n)
+	}
+}
+
+func TestJobsQueueAndCancel(t *testing.T) {
+	api, es := newTestServer(t)
+	// Hold the first job's search until it is cancelled
+	es.Fail(estest.Search, 1, estest.Fault{Delay: time.Minute})
+
+	var running, queued Job
+	call(t, api, http.MethodPost, "/jobs", `{"index":"logs"}`, &running)
+	call(t, api, http.MethodPost, "/jobs", `{"index":"logs"}`, &queued)
+	var answer map[string]string
+	if code := call(t, api, http.MethodPost, "/jobs", `{"index":"logs"}`, &answer); code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status %d with the queue full but got %d: %v", http.StatusServiceUnavailable, code, answer)
+	}
+
+	for _, id := range []string{queued.ID, running.ID} {
+		if code := call(t, api, http.MethodPost, "/jobs/"+id+"/cancel", "", nil); code != http.StatusAccepted {
+			t.Errorf("Expected status %d cancelling job but got %d", http.StatusAccepted, code)
+		}
+		if job := waitFor(t, api, id); job.Status != StatusCancelled {
+			t.Errorf("Expected job to be cancelled but got %+v", job)
+		}
+	}
+	if code := call(t, api, http.MethodPost, "/jobs/"+queued.ID+"/cancel", "", nil); code != http.StatusConflict {
+		t.Errorf("Expected status %d cancelling a finished job but got %d", http.StatusConflict, code)
+	}
+	if code := call(t, api, http.MethodGet, "/jobs/"+running.ID+"/result", "", nil); code != http.StatusConflict {
+		t.Errorf("Expected status %d for the result of a cancelled job but got %d", http.StatusConflict, code)
+	}
+}
+
+func TestSubmitRejectsInvalidJobs(t *testing.T) {
+	api, _ := newTestServer(t)
+
+	for _, body := range []string{
+		`{"query":{"match_all":{}}}`,
+		`{"index":"logs","format":"xml"}`,
+		`{"index":"logs","query":"{\"size\":\"{{size:int}}\"}"}`,
+		`{"index":"logs","sink":"jsonl"}`,
+	} {
+		var answer map[string]string
+		if code := call(t, api, http.MethodPost, "/jobs", body, &answer); code != http.StatusBadRequest {
+			t.Errorf("Expected status %d for %s but got %d", http.StatusBadRequest, body, code)
+		}
+		if answer["error"] == "" {
+			t.Errorf("Expected an error message for %s", body)
+		}
+	}
+	if code := call(t, api, http.MethodGet, "/jobs/unknown", "", nil); code != http.StatusNotFound {
+		t.Errorf("Expected status %d for an unknown job but got %d", http.StatusNotFound, code)
+	}
+}
+
+func TestAPIRequiresToken(t *testing.T) {
+	manager, _ := newTestManager(t, nil)
+	api := httptest.NewServer(NewHandler(manager, "s3cret"))
+	defer api.Close()
+
+	tests := []struct {
+		path, authorization string
+		expected            int
+	}{
+		{"/jobs", "", http.StatusUnauthorized},
+		{"/jobs", "Bearer wrong", http.StatusUnauthorized},
+		{"/jobs", "Basic s3cret", http.StatusUnauthorized},
+		{"/jobs", "Bearer s3cret", http.StatusOK},
+		{"/metrics", "", http.StatusUnauthorized},
+		{"/healthz", "", http.StatusOK},
+	}
+	for _, test := range tests {
+		req, err := http.NewRequest(http.MethodGet, api.URL+test.path, nil)
+		if err != nil {
+			t.Fatalf("Error creating request: %s", err)
+		}
+		if test.authorization != "" {
+			req.Header.Set("Authorization", test.authorization)
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Error calling %s: %s", test.path, err)
+		}
+		res.Body.Close()
+		if res.StatusCode != test.expected {
+			t.Errorf("Expected status %d for %s with %q but got %d", test.expected, test.path, test.authorization, res.StatusCode)
+		}
+	}
+}
+
+func TestFinishedJobsArePruned(t *testing.T) {
+	var cfg *config.Config
+	manager, _ := newTestManager(t, func(c *config.Config) {
+		c.JobHistory = 1
+		cfg = c
+	})
+	api := httptest.NewServer(NewHandler(manager, ""))
+	defer api.Close()
+
+	var first, second Job
+	call(t, api, http.MethodPost, "/jobs", `{"index":"logs"}`, &first)
+	waitFor(t, api, first.ID)
+	call(t, api, http.MethodPost, "/jobs", `{"index":"logs"}`, &second)
+	waitFor(t, api, second.ID)
+
+	// Only the most recent job is kept, with its result
+	if _, err := manager.Get(first.ID); err != ErrNotFound {
+		t.Errorf("Expected the first job to be pruned but got %v", err)
+	}
+	if results, _ := filepath.Glob(filepath.Join(cfg.JobsDir, "*")); len(results) != 1 || !strings.Contains(results[0], second.ID) {
+		t.Errorf("Expected only the result of the second job but got %v", results)
+	}
+
+	// Once the retention has passed it goes too
+	manager.mu.Lock()
+	manager.prune(time.Now().Add(cfg.JobRetention + time.Minute))
+	manager.mu.Unlock()
+	if jobs := manager.List(); len(jobs) != 0 {
+		t.Errorf("Expected every job to be pruned but got %+v", jobs)
+	}
+	if results, _ := filepath.Glob(filepath.Join(cfg.JobsDir, "*")); len(results) != 0 {
+		t.Errorf("Expected every result to be deleted but got %v", results)
+	}
+}
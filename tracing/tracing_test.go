@@ -0,0 +1,53 @@
+// tracing/tracing_test.go
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+func TestTransportPropagatesTraceContext(t *testing.T) {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	tracer := sdktrace.NewTracerProvider().Tracer("test")
+
+	var traceparent []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = append(traceparent, r.Header.Get("traceparent"))
+	}))
+	defer server.Close()
+	httpClient := &http.Client{Transport: Transport(http.DefaultTransport)}
+
+	ctx, span := tracer.Start(context.Background(), "search")
+	for _, ctx := range []context.Context{ctx, context.Background()} {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+		if err != nil {
+			t.Fatalf("Error creating request: %s", err)
+		}
+		res, err := httpClient.Do(req)
+		if err != nil {
+			t.Fatalf("Error sending request: %s", err)
+		}
+		res.Body.Close()
+		if req.Header.Get("traceparent") != "" {
+			t.Errorf("Expected the request given to the transport to be left unchanged")
+		}
+	}
+	span.End()
+
+	expected := "00-" + span.SpanContext().TraceID().String() + "-" + span.SpanContext().SpanID().String() + "-01"
+	if len(traceparent) != 2 || traceparent[0] != expected || traceparent[1] != "" {
+		t.Errorf("Expected traceparent %q on the first request only but got %q", expected, traceparent)
+	}
+}
+
+func TestSetupRejectsUnknownExporter(t *testing.T) {
+	if _, err := Setup(context.Background(), "jaeger", ""); err == nil {
+		t.Errorf("Expected an error for an unknown exporter")
+	}
+}